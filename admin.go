@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cyverse-de/templeton/database"
+	"github.com/cyverse-de/templeton/elasticsearch"
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// reindexRequest is the body accepted when starting a reindex. Either the targets of a template or the objects matched
+// by a filter may be reindexed; if neither is given, everything is reindexed.
+type reindexRequest struct {
+	TemplateID string                 `json:"template_id"`
+	Filter     *database.ObjectFilter `json:"filter"`
+}
+
+// logLevelRequest is the body accepted, and returned, by the log level endpoint
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// errorResponse is the body returned when an admin request fails
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// adminAPI serves the operator endpoints on the debug listener
+type adminAPI struct {
+	es    *elasticsearch.Elasticer
+	d     *database.Databaser
+	token string
+
+	// ctx is the context reindexes run in, so that they stop when the service shuts down
+	ctx context.Context
+
+	// reindexes is shared with the periodic reindex message handler, so that reindexes started from either one don't
+	// overlap
+	reindexes *reindexTracker
+}
+
+func newAdminAPI(ctx context.Context, es *elasticsearch.Elasticer, d *database.Databaser, reindexes *reindexTracker, token string) *adminAPI {
+	return &adminAPI{es: es, d: d, token: token, ctx: ctx, reindexes: reindexes}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
+
+// authorize wraps handler so that it's only called for requests bearing the configured token
+func (a *adminAPI) authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleReindexOne reindexes the entity whose ID ends the path and returns the result
+func (a *adminAPI) handleReindexOne(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	parsed, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, "/admin/reindex/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id := parsed.String()
+
+	ctx := logging.WithFields(r.Context(), logrus.Fields{"entity": id})
+	logging.ForContext(ctx, log).Info("Reindexing entity requested through the admin API")
+
+	// This goes through the bulk indexer rather than IndexOne so that nothing is written in dry run mode.
+	result := a.es.IndexIDs(ctx, a.d, []string{id}, 1, 1)
+	status := http.StatusOK
+	if !result.OK() {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, result)
+}
+
+// handlePreview returns what reindexing the entity whose ID ends the path would do, without doing it
+func (a *adminAPI) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/admin/preview/")
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	preview, err := a.es.Preview(r.Context(), a.d, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
+
+// handleReindex starts a reindex on POST and reports the current or last one on GET
+func (a *adminAPI) handleReindex(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		job := a.reindexes.status()
+		if job == nil {
+			writeError(w, http.StatusNotFound, errors.New("no reindex has been started"))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+
+	case http.MethodPost:
+		var req reindexRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if req.TemplateID != "" {
+			if _, err := uuid.Parse(req.TemplateID); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if !req.Filter.IsEmpty() {
+				writeError(w, http.StatusBadRequest, errors.New("template_id and filter can't be combined"))
+				return
+			}
+		}
+		if req.Filter.IsEmpty() {
+			req.Filter = nil
+		}
+
+		job, err := a.startReindex(req)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// startReindex runs a reindex in the background and returns its initial status
+func (a *adminAPI) startReindex(req reindexRequest) (*reindexJob, error) {
+	job, err := a.reindexes.start(reindexSourceAdmin, req.TemplateID, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := a.reindexes.attempt(a.ctx, job)
+	if req.TemplateID != "" {
+		ctx = logging.WithFields(ctx, logrus.Fields{"template_id": req.TemplateID})
+	}
+
+	go func() {
+		log := logging.ForContext(ctx, log)
+		log.Info("Reindex requested through the admin API")
+
+		var (
+			result *elasticsearch.ReindexResult
+			err    error
+		)
+		if req.TemplateID != "" {
+			result, err = a.es.IndexTemplate(ctx, a.d, req.TemplateID)
+		} else {
+			result, err = a.es.ReindexFiltered(ctx, a.d, req.Filter)
+		}
+		log.Infof("Reindex finished: %s", result)
+		if err != nil {
+			log.Errorf("Reindex stopped early: %s", err)
+		}
+		a.reindexes.finish(job, result, err)
+	}()
+
+	return a.reindexes.describe(job), nil
+}
+
+// handleLogLevel changes the log level on PUT and reports it on GET
+func (a *adminAPI) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := logging.SetLevel(req.Level); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Infof("Log level changed to %s through the admin API", req.Level)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, &logLevelRequest{Level: logging.Level()})
+}
+
+// register adds the admin endpoints to the debug listener
+func (a *adminAPI) register() {
+	http.HandleFunc("/admin/reindex/", a.authorize(a.handleReindexOne))
+	http.HandleFunc("/admin/reindex", a.authorize(a.handleReindex))
+	http.HandleFunc("/admin/preview/", a.authorize(a.handlePreview))
+	http.HandleFunc("/admin/log-level", a.authorize(a.handleLogLevel))
+}
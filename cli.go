@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cyverse-de/templeton/database"
+	"github.com/cyverse-de/templeton/elasticsearch"
+	"github.com/cyverse-de/templeton/throttle"
+	"github.com/google/uuid"
+)
+
+// The commands templeton can run, as they're written on the command line
+const (
+	cmdServePeriodic    = "serve periodic"
+	cmdServeIncremental = "serve incremental"
+	cmdReindexFull      = "reindex full"
+	cmdReindexIDs       = "reindex ids"
+	cmdInspect          = "inspect"
+	cmdVerify           = "verify"
+	cmdExport           = "export"
+	cmdImport           = "import"
+	cmdVersion          = "version"
+)
+
+// modeCommands maps the values of the --mode flag to the commands they're aliases for
+var modeCommands = map[string]string{
+	"periodic":    cmdServePeriodic,
+	"incremental": cmdServeIncremental,
+	"full":        cmdReindexFull,
+	"verify":      cmdVerify,
+}
+
+// dryRunCommands are the commands that support --dry-run
+var dryRunCommands = map[string]bool{
+	cmdServePeriodic: true,
+	cmdReindexFull:   true,
+	cmdReindexIDs:    true,
+	cmdImport:        true,
+}
+
+const usageText = `Usage: templeton [flags] <command> [arguments]
+
+Commands:
+  serve periodic       Reindex everything whenever a reindex message is received.
+  serve incremental    Reindex single entities whenever an update message is received.
+  reindex full         Reindex everything once, or only the objects matched by the filter flags.
+  reindex ids [id...]  Reindex the given entities, or the ones read from --ids-file or stdin, one per line.
+  inspect <id>         Show what would be indexed for an entity and how it differs from the index.
+  verify               Compare the database with the index without changing either.
+  export               Write the documents that would be indexed, optionally filtered, without using the index.
+  import <file>        Load documents written by export into the index. Use - for stdin.
+  version              Print version information.
+
+Flags may be given before or after the command.
+
+Flags:
+`
+
+func usage() {
+	fmt.Fprint(flag.CommandLine.Output(), usageText)
+	flag.PrintDefaults()
+}
+
+// parseInterspersed parses the flags in args, wherever they appear, and returns the remaining arguments in order.
+// Everything after a "--" argument is returned without being parsed.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		// Errors exit the process, since fs is expected to use flag.ExitOnError.
+		_ = fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...)
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// resolveCommand returns the command named by args, or by the --mode and --version flags, and its arguments
+func resolveCommand(args []string) (string, []string, error) {
+	if *showVersion {
+		return cmdVersion, nil, nil
+	}
+
+	var (
+		cmd     string
+		cmdArgs []string
+	)
+
+	switch {
+	case *mode != "" && len(args) > 0:
+		return "", nil, errors.New("--mode can't be combined with a command")
+
+	case *mode != "":
+		var ok bool
+		if cmd, ok = modeCommands[*mode]; !ok {
+			return "", nil, fmt.Errorf("invalid mode: %s", *mode)
+		}
+
+	case len(args) == 0:
+		return "", nil, errors.New("a command is required")
+
+	case args[0] == "serve" || args[0] == "reindex":
+		if len(args) < 2 {
+			return "", nil, fmt.Errorf("%s requires a subcommand", args[0])
+		}
+		cmd = args[0] + " " + args[1]
+		cmdArgs = args[2:]
+
+	default:
+		cmd = args[0]
+		cmdArgs = args[1:]
+	}
+
+	switch cmd {
+	case cmdServePeriodic, cmdServeIncremental, cmdReindexFull, cmdVerify, cmdExport, cmdVersion:
+		if len(cmdArgs) > 0 {
+			return "", nil, fmt.Errorf("%s doesn't take any arguments", cmd)
+		}
+	case cmdInspect:
+		if len(cmdArgs) != 1 {
+			return "", nil, errors.New("inspect takes exactly one ID")
+		}
+	case cmdImport:
+		if len(cmdArgs) != 1 {
+			return "", nil, errors.New("import takes exactly one file")
+		}
+	case cmdReindexIDs:
+		if *idsFile != "" && len(cmdArgs) > 0 {
+			return "", nil, errors.New("reindex ids takes either --ids-file or IDs as arguments, not both")
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown command: %s", cmd)
+	}
+
+	if (cmd == cmdExport || cmd == cmdImport) && *exportFormat != elasticsearch.FormatNDJSON && *exportFormat != elasticsearch.FormatBulk {
+		return "", nil, fmt.Errorf("invalid --format: %s", *exportFormat)
+	}
+
+	if *dryRun && !dryRunCommands[cmd] {
+		return "", nil, fmt.Errorf("--dry-run is not supported by %s", cmd)
+	}
+
+	return cmd, cmdArgs, nil
+}
+
+// parseFilterTime parses the value of a time range flag, leaving the time unset if the flag wasn't given
+func parseFilterTime(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return &t, nil
+}
+
+// objectFilter returns the filter given by the filter flags, which are only supported by the reindex full and export
+// commands
+func objectFilter(cmd string) (*database.ObjectFilter, error) {
+	var err error
+	filter := &database.ObjectFilter{
+		TargetType: *filterTargetType,
+		CreatedBy:  *filterCreatedBy,
+		ModifiedBy: *filterModifiedBy,
+		Attribute:  *filterAttribute,
+	}
+	if filter.ModifiedAfter, err = parseFilterTime("modified-after", *filterModifiedAfter); err != nil {
+		return nil, err
+	}
+	if filter.ModifiedBefore, err = parseFilterTime("modified-before", *filterModifiedBefore); err != nil {
+		return nil, err
+	}
+
+	if !filter.IsEmpty() && cmd != cmdReindexFull && cmd != cmdExport {
+		return nil, fmt.Errorf("filters are not supported by %s", cmd)
+	}
+	return filter, nil
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) bool {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	fmt.Println(string(out))
+	return true
+}
+
+// readIDs returns the non-blank lines of r, with surrounding whitespace removed
+func readIDs(r io.Reader) ([]string, error) {
+	var ids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// loadIDs returns the IDs given as arguments, or read from --ids-file or stdin if there are none
+func loadIDs(args []string) ([]string, error) {
+	path := *idsFile
+	if path == "" {
+		if len(args) > 0 && !(len(args) == 1 && args[0] == "-") {
+			return args, nil
+		}
+		path = "-"
+	}
+
+	if path == "-" {
+		return readIDs(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readIDs(f)
+}
+
+// doReindexIDs reindexes the entities given as arguments, or read from a file or stdin, and prints the result as
+// JSON. Invalid IDs are reported as failures alongside the ones that couldn't be reindexed. It returns false if there
+// were any failures.
+func doReindexIDs(ctx context.Context, es *elasticsearch.Elasticer, d *database.Databaser, args []string) bool {
+	ids, err := loadIDs(args)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+
+	// IDs copied from logs often repeat and vary in case, so reindex each one once, in canonical form
+	seen := make(map[string]bool, len(ids))
+	valid := make([]string, 0, len(ids))
+	var invalid []elasticsearch.ItemFailure
+	for _, id := range ids {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			invalid = append(invalid, elasticsearch.ItemFailure{ID: id, Reason: err.Error()})
+			continue
+		}
+		if canonical := parsed.String(); !seen[canonical] {
+			seen[canonical] = true
+			valid = append(valid, canonical)
+		}
+	}
+	log.Infof("Reindexing %d entities in batches of %d; %d invalid IDs were skipped.", len(valid), *batchSize, len(invalid))
+
+	result := es.IndexIDs(ctx, d, valid, *batchSize, *concurrency)
+	for _, failure := range invalid {
+		result.AddItemFailure(failure.ID, fmt.Errorf("invalid ID: %s", failure.Reason))
+	}
+	log.Infof("Reindex finished: %s", result)
+
+	return printJSON(result) && result.OK()
+}
+
+// doInspect prints what would be indexed for one entity, and how it differs from the index, as JSON
+func doInspect(ctx context.Context, es *elasticsearch.Elasticer, d *database.Databaser, id string) bool {
+	if _, err := uuid.Parse(id); err != nil {
+		log.Errorf("Invalid ID %q: %s", id, err)
+		return false
+	}
+
+	preview, err := es.Preview(ctx, d, id)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return printJSON(preview)
+}
+
+// doExport writes the documents that would be indexed to --output, and logs a summary. If the output is a file, the
+// summary is also printed as JSON. It returns false if the export stopped early or any object failed.
+func doExport(ctx context.Context, es *elasticsearch.Elasticer, d *database.Databaser, filter *database.ObjectFilter) bool {
+	var (
+		out  io.Writer = os.Stdout
+		file *os.File
+		err  error
+	)
+	if *outputPath != "-" {
+		if file, err = os.Create(*outputPath); err != nil {
+			log.Error(err)
+			return false
+		}
+		out = file
+	}
+
+	buffered := bufio.NewWriter(out)
+	out = buffered
+
+	var gz *gzip.Writer
+	if *gzipOutput {
+		gz = gzip.NewWriter(buffered)
+		out = gz
+	}
+
+	result, err := es.Export(ctx, d, filter, *exportFormat, out)
+
+	// Everything is closed even if the export stopped early, so that what was written can still be read.
+	closers := []func() error{buffered.Flush}
+	if gz != nil {
+		closers = append([]func() error{gz.Close}, closers...)
+	}
+	if file != nil {
+		closers = append(closers, file.Close)
+	}
+	for _, c := range closers {
+		if closeErr := c(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	log.Infof("Export finished: %s", result)
+	if err != nil {
+		log.Errorf("Export stopped early: %s", err)
+	}
+
+	ok := err == nil && result.Failed == 0
+	if *outputPath != "-" {
+		ok = printJSON(result) && ok
+	}
+	return ok
+}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// doImport loads the documents in path, or stdin if it's -, into the index and prints the result as JSON. Gzipped
+// input is decompressed. It returns false if the input couldn't be read or any document failed.
+func doImport(ctx context.Context, es *elasticsearch.Elasticer, path string) bool {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Error(err)
+			return false
+		}
+		defer f.Close()
+		in = f
+	}
+
+	buffered := bufio.NewReader(in)
+	in = buffered
+	if magic, err := buffered.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			log.Error(err)
+			return false
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	result, err := es.Import(ctx, in, *exportFormat, *importIndex, *batchSize, throttle.NewLimiter(*importRate))
+	log.Infof("Import finished: %s", result)
+	if err != nil {
+		log.Errorf("Import stopped early: %s", err)
+	}
+
+	return printJSON(result) && err == nil && result.OK()
+}
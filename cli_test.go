@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		config     string
+		verbose    bool
+	}{
+		{
+			name: "no arguments",
+		},
+		{
+			name:    "flags only",
+			args:    []string{"--config", "a.yml", "-v"},
+			config:  "a.yml",
+			verbose: true,
+		},
+		{
+			name:       "positionals only",
+			args:       []string{"reindex", "ids", "x"},
+			positional: []string{"reindex", "ids", "x"},
+		},
+		{
+			name:       "flags before positionals",
+			args:       []string{"-config=a.yml", "reindex", "x"},
+			positional: []string{"reindex", "x"},
+			config:     "a.yml",
+		},
+		{
+			name:       "flags after positionals",
+			args:       []string{"reindex", "x", "--config", "a.yml", "-v"},
+			positional: []string{"reindex", "x"},
+			config:     "a.yml",
+			verbose:    true,
+		},
+		{
+			name:       "flags between positionals",
+			args:       []string{"reindex", "-v", "x", "--config", "a.yml", "y"},
+			positional: []string{"reindex", "x", "y"},
+			config:     "a.yml",
+			verbose:    true,
+		},
+		{
+			name:       "double dash ends flags",
+			args:       []string{"reindex", "-v", "--", "-x", "--config", "a.yml"},
+			positional: []string{"reindex", "-x", "--config", "a.yml"},
+			verbose:    true,
+		},
+		{
+			name:       "double dash first",
+			args:       []string{"--", "-v"},
+			positional: []string{"-v"},
+		},
+		{
+			name:       "trailing double dash",
+			args:       []string{"reindex", "--"},
+			positional: []string{"reindex"},
+		},
+		{
+			name:       "double dash after a double dash is positional",
+			args:       []string{"a", "--", "b", "--", "-v"},
+			positional: []string{"a", "b", "--", "-v"},
+		},
+		{
+			name:       "single dash is positional",
+			args:       []string{"import", "-", "-v"},
+			positional: []string{"import", "-"},
+			verbose:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			config := fs.String("config", "", "")
+			verbose := fs.Bool("v", false, "")
+
+			positional := parseInterspersed(fs, tt.args)
+			if !reflect.DeepEqual(positional, tt.positional) {
+				t.Errorf("positional = %q, want %q", positional, tt.positional)
+			}
+			if *config != tt.config {
+				t.Errorf("config = %q, want %q", *config, tt.config)
+			}
+			if *verbose != tt.verbose {
+				t.Errorf("verbose = %v, want %v", *verbose, tt.verbose)
+			}
+		})
+	}
+}
@@ -6,13 +6,16 @@ import (
 	"fmt"
 
 	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/cyverse-de/dbutil"
 	"github.com/cyverse-de/templeton/logging"
 	"github.com/cyverse-de/templeton/model"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
-
-	_ "github.com/lib/pq" // blank import for driver
 )
 
 var (
@@ -26,6 +29,37 @@ type Databaser struct {
 	db         *sql.DB
 	schema     string
 	ConnString string
+
+	ontologies      *model.OntologyHierarchy
+	ontologiesMutex sync.RWMutex
+
+	readThrottle *readThrottle
+}
+
+// applicationName identifies templeton's connections in pg_stat_activity, unless the connection string names it
+// something else
+const applicationName = "templeton"
+
+// withApplicationName adds applicationName to a connection string, in either URL or key=value form, if it doesn't
+// already set an application name
+func withApplicationName(connString string) (string, error) {
+	if !strings.Contains(connString, "://") {
+		if strings.Contains(connString, "application_name=") {
+			return connString, nil
+		}
+		return strings.TrimSpace(connString + " application_name=" + applicationName), nil
+	}
+
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if query.Get("application_name") == "" {
+		query.Set("application_name", applicationName)
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
 }
 
 // NewDatabaser returns a pointer to a Databaser instance that has already
@@ -36,7 +70,12 @@ func NewDatabaser(connString, schema string) (*Databaser, error) {
 		return nil, err
 	}
 
-	db, err := connector.Connect("postgres", connString)
+	named, err := withApplicationName(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := connector.Connect("postgres", named)
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +88,16 @@ func NewDatabaser(connString, schema string) (*Databaser, error) {
 	return databaser, nil
 }
 
+// Ping verifies that the database can still be reached.
+func (d *Databaser) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+// Close closes the underlying database connection pool.
+func (d *Databaser) Close() error {
+	return d.db.Close()
+}
+
 // avuRecordFromRow converts a sql.Rows from a result set to a AVU record
 // It would be great if they'd provided an interface for *this* Scan method
 // (sql.Scanner is for the other one) but we'll just have to live with being
@@ -67,6 +116,8 @@ func avuRecordFromRow(row *sql.Rows) (*model.AVURecord, error) {
 		&ar.ModifiedBy,
 		&ar.CreatedOn,
 		&ar.ModifiedOn,
+		&ar.TemplateID,
+		&ar.TemplateName,
 	)
 
 	return ar, err
@@ -83,9 +134,19 @@ const _selectAVU = `
 	       created_by,
 	       modified_by,
 	       created_on,
-	       modified_on
-	  FROM %s.avus
-	  %s
+	       modified_on,
+	       coalesce(cast(tmpl.template_id as varchar), '') AS template_id,
+	       coalesce(tmpl.name, '') AS template_name
+	  FROM %[1]s.avus
+	  LEFT JOIN LATERAL (
+	       SELECT ti.template_id, t.name
+	         FROM %[1]s.template_instances ti
+	         JOIN %[1]s.templates t ON (t.id = ti.template_id)
+	        WHERE ti.avu_id = avus.id
+	        ORDER BY ti.template_id
+	        LIMIT 1
+	  ) tmpl ON true
+	  %[2]s
 	UNION ALL
 	SELECT cast(avus.id as varchar),
 	       coalesce(avus.attribute, ''),
@@ -96,26 +157,107 @@ const _selectAVU = `
 	       avus.created_by,
 	       avus.modified_by,
 	       avus.created_on,
-	       avus.modified_on
-	  FROM %s.avus
+	       avus.modified_on,
+	       coalesce(cast(tmpl.template_id as varchar), ''),
+	       coalesce(tmpl.name, '')
+	  FROM %[1]s.avus
 	  JOIN all_avus aa ON (avus.target_id = cast(aa.id as uuid) AND avus.target_type = 'avu')
-	) SELECT * from all_avus ORDER BY target_id;
+	  LEFT JOIN LATERAL (
+	       SELECT ti.template_id, t.name
+	         FROM %[1]s.template_instances ti
+	         JOIN %[1]s.templates t ON (t.id = ti.template_id)
+	        WHERE ti.avu_id = avus.id
+	        ORDER BY ti.template_id
+	        LIMIT 1
+	  ) tmpl ON true
+	) SELECT * from all_avus ORDER BY target_id COLLATE "C", id;
 `
 
 // selectAVUsWhere generates a SELECT FROM avus with a given WHERE clause (or no WHERE, given an empty string)
 func selectAVUsWhere(schema, where string) string {
 	if where != "" {
-		return fmt.Sprintf(_selectAVU, schema, fmt.Sprintf("WHERE %s", where), schema)
+		return fmt.Sprintf(_selectAVU, schema, fmt.Sprintf("WHERE %s", where))
+	}
+	return fmt.Sprintf(_selectAVU, schema, "")
+}
+
+const _selectComments = `
+	SELECT cast(id as varchar),
+	       coalesce(value, ''),
+	       owner_id,
+	       post_time,
+	       cast(target_id as varchar),
+	       cast(target_type as varchar)
+	  FROM %s.comments
+	 WHERE NOT deleted
+	   AND NOT retracted
+	   %s
+	 ORDER BY cast(target_id as varchar) COLLATE "C", post_time;
+`
+
+// selectCommentsWhere generates a SELECT FROM comments for visible comments, with an additional condition (or none, given an empty string)
+func selectCommentsWhere(schema, and string) string {
+	if and != "" {
+		return fmt.Sprintf(_selectComments, schema, fmt.Sprintf("AND %s", and))
 	}
-	return fmt.Sprintf(_selectAVU, schema, "", schema)
+	return fmt.Sprintf(_selectComments, schema, "")
+}
+
+// commentRecordFromRow converts a sql.Rows from a result set to a comment record
+func commentRecordFromRow(row *sql.Rows) (*model.CommentRecord, error) {
+	cr := &model.CommentRecord{}
+
+	err := row.Scan(
+		&cr.ID,
+		&cr.Value,
+		&cr.OwnerID,
+		&cr.PostTime,
+		&cr.TargetId,
+		&cr.TargetType,
+	)
+
+	return cr, err
+}
+
+const _selectFavorites = `
+	SELECT owner_id,
+	       cast(target_id as varchar),
+	       cast(target_type as varchar)
+	  FROM %s.favorites
+	  %s
+	 ORDER BY cast(target_id as varchar) COLLATE "C", owner_id;
+`
+
+// selectFavoritesWhere generates a SELECT FROM favorites with a given WHERE clause (or no WHERE, given an empty string)
+func selectFavoritesWhere(schema, where string) string {
+	if where != "" {
+		return fmt.Sprintf(_selectFavorites, schema, fmt.Sprintf("WHERE %s", where))
+	}
+	return fmt.Sprintf(_selectFavorites, schema, "")
+}
+
+// favoriteRecordFromRow converts a sql.Rows from a result set to a favorite record
+func favoriteRecordFromRow(row *sql.Rows) (*model.FavoriteRecord, error) {
+	fr := &model.FavoriteRecord{}
+
+	err := row.Scan(
+		&fr.OwnerID,
+		&fr.TargetId,
+		&fr.TargetType,
+	)
+
+	return fr, err
 }
 
 // GetAVU returns a model.AVURecord from the database
 func (d *Databaser) GetAVU(ctx context.Context, uuid string) (*model.AVURecord, error) {
+	ctx, q := startQuery(ctx, "GetAVU")
+	defer q.end()
+
 	query := selectAVUsWhere(d.schema, "id = cast($1 as uuid)")
 	rows, err := d.db.QueryContext(ctx, query, uuid)
 	if err != nil {
-		return nil, err
+		return nil, q.fail(err)
 	}
 	defer rows.Close()
 
@@ -124,106 +266,571 @@ func (d *Databaser) GetAVU(ctx context.Context, uuid string) (*model.AVURecord,
 		if err == nil {
 			err = sql.ErrNoRows
 		}
-		return nil, err
+		return nil, q.fail(err)
 	}
 	ar, err := avuRecordFromRow(rows)
 	if err != nil {
-		return nil, err
+		return nil, q.fail(err)
 	}
 	if rows.Next() {
-		return ar, fmt.Errorf("AVU Query for %s returned more than one row", uuid)
+		return ar, q.fail(fmt.Errorf("AVU Query for %s returned more than one row", uuid))
 	}
 	return ar, nil
 }
 
 // GetObjectAVUs returns a slice of model.AVURecord structs by UUID
 func (d *Databaser) GetObjectAVUs(ctx context.Context, uuid string) ([]model.AVURecord, error) {
+	ctx, q := startQuery(ctx, "GetObjectAVUs")
+	defer q.end()
+
 	query := selectAVUsWhere(d.schema, "target_id = cast($1 as uuid)")
 
 	rows, err := d.db.QueryContext(ctx, query, uuid)
 	if err != nil {
-		return nil, err
+		return nil, q.fail(err)
 	}
 	defer rows.Close()
 	var retval []model.AVURecord
 	for rows.Next() {
+		q.rows++
 		ar, err := avuRecordFromRow(rows)
 		if err != nil {
-			return nil, err
+			return nil, q.fail(err)
 		}
 		retval = append(retval, *ar)
 	}
-	err = rows.Err()
-	return retval, err
+	return retval, q.fail(rows.Err())
 }
 
-type objectCursor struct {
-	rows     *sql.Rows
-	lastRow  *model.AVURecord
-	moreRows bool
-	anyRows  bool
+// GetObjectComments returns a slice of model.CommentRecord structs for the visible comments on a target, by UUID
+func (d *Databaser) GetObjectComments(ctx context.Context, uuid string) ([]model.CommentRecord, error) {
+	ctx, q := startQuery(ctx, "GetObjectComments")
+	defer q.end()
+
+	query := selectCommentsWhere(d.schema, "target_id = cast($1 as uuid)")
+
+	rows, err := d.db.QueryContext(ctx, query, uuid)
+	if err != nil {
+		return nil, q.fail(err)
+	}
+	defer rows.Close()
+	var retval []model.CommentRecord
+	for rows.Next() {
+		q.rows++
+		cr, err := commentRecordFromRow(rows)
+		if err != nil {
+			return nil, q.fail(err)
+		}
+		retval = append(retval, *cr)
+	}
+	return retval, q.fail(rows.Err())
 }
 
-func newObjectCursor(rows *sql.Rows) *objectCursor {
-	return &objectCursor{
-		rows:     rows,
-		lastRow:  &model.AVURecord{TargetId: ""},
-		moreRows: true,
-		anyRows:  false}
+// GetObjectFavorites returns a slice of model.FavoriteRecord structs for a target, by UUID
+func (d *Databaser) GetObjectFavorites(ctx context.Context, uuid string) ([]model.FavoriteRecord, error) {
+	ctx, q := startQuery(ctx, "GetObjectFavorites")
+	defer q.end()
+
+	query := selectFavoritesWhere(d.schema, "target_id = cast($1 as uuid)")
+
+	rows, err := d.db.QueryContext(ctx, query, uuid)
+	if err != nil {
+		return nil, q.fail(err)
+	}
+	defer rows.Close()
+	var retval []model.FavoriteRecord
+	for rows.Next() {
+		q.rows++
+		fr, err := favoriteRecordFromRow(rows)
+		if err != nil {
+			return nil, q.fail(err)
+		}
+		retval = append(retval, *fr)
+	}
+	return retval, q.fail(rows.Err())
 }
 
-func (o *objectCursor) Next() ([]model.AVURecord, error) {
-	if !o.moreRows {
-		return nil, EOS
+// GetObject returns the AVUs, comments, and favorites for a target, by UUID
+func (d *Databaser) GetObject(ctx context.Context, uuid string) (*model.ObjectRecords, error) {
+	avus, err := d.GetObjectAVUs(ctx, uuid)
+	if err != nil {
+		return nil, err
 	}
 
-	var retval []model.AVURecord
+	comments, err := d.GetObjectComments(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
 
-	if o.lastRow.TargetId != "" {
-		retval = append(retval, *o.lastRow)
+	favorites, err := d.GetObjectFavorites(ctx, uuid)
+	if err != nil {
+		return nil, err
 	}
 
-	for o.moreRows {
-		o.moreRows = o.rows.Next()
-		if !o.moreRows {
-			break
+	var templateIDs []string
+	for _, avu := range avus {
+		if avu.TemplateID != "" {
+			templateIDs = append(templateIDs, avu.TemplateID)
 		}
-		o.anyRows = true
+	}
+	templates := make(map[string]*model.Template)
+	if len(templateIDs) > 0 {
+		templates, err = d.GetTemplateDefinitions(ctx, templateIDs...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	obj := &model.ObjectRecords{
+		AVUs:       avus,
+		Comments:   comments,
+		Favorites:  favorites,
+		Templates:  templates,
+		Ontologies: d.Ontologies(),
+	}
+	obj.SetTarget(uuid)
+	return obj, nil
+}
+
+const _selectHasRecords = `
+	SELECT EXISTS (SELECT 1 FROM %[1]s.avus WHERE target_id = cast($1 as uuid))
+	    OR EXISTS (SELECT 1 FROM %[1]s.comments WHERE target_id = cast($1 as uuid) AND NOT deleted AND NOT retracted)
+	    OR EXISTS (SELECT 1 FROM %[1]s.favorites WHERE target_id = cast($1 as uuid));
+`
+
+// HasRecords returns whether a target has any AVUs, visible comments, or favorites, which is what it takes for the
+// target to have a document in the index
+func (d *Databaser) HasRecords(ctx context.Context, uuid string) (bool, error) {
+	ctx, q := startQuery(ctx, "HasRecords")
+	defer q.end()
+
+	var exists bool
+	if err := d.db.QueryRowContext(ctx, fmt.Sprintf(_selectHasRecords, d.schema), uuid).Scan(&exists); err != nil {
+		return false, q.fail(err)
+	}
+	q.rows++
+	return exists, nil
+}
 
-		ar, err := avuRecordFromRow(o.rows)
+// queryRecords runs query and returns every record it reads. The rows are closed before it returns.
+func queryRecords[T any](ctx context.Context, d *Databaser, scan func(*sql.Rows) (*T, error), query string, args ...interface{}) ([]T, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var retval []T
+	for rows.Next() {
+		record, err := scan(rows)
 		if err != nil {
 			return nil, err
 		}
+		retval = append(retval, *record)
+	}
+	return retval, rows.Err()
+}
+
+// objectRecords returns the AVUs, visible comments, and favorites of the given targets, counting them in the query
+// span q. Each result set is read in full before the next query starts.
+func (d *Databaser) objectRecords(ctx context.Context, q *querySpan, uuids []string) ([]model.AVURecord, []model.CommentRecord, []model.FavoriteRecord, error) {
+	ids := pq.Array(uuids)
+	condition := "target_id = ANY(cast($1 as uuid[]))"
 
-		if o.lastRow.TargetId == "" || o.lastRow.TargetId == ar.TargetId {
-			o.lastRow = ar
-			retval = append(retval, *ar)
-		} else {
-			o.lastRow = ar
-			break
+	avus, err := queryRecords(ctx, d, avuRecordFromRow, selectAVUsWhere(d.schema, condition), ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	q.rows += len(avus)
+
+	comments, err := queryRecords(ctx, d, commentRecordFromRow, selectCommentsWhere(d.schema, condition), ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	q.rows += len(comments)
+
+	favorites, err := queryRecords(ctx, d, favoriteRecordFromRow, selectFavoritesWhere(d.schema, condition), ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	q.rows += len(favorites)
+	return avus, comments, favorites, nil
+}
+
+// groupObjects collects the records into one ObjectRecords per target, sorted by target ID. The records may be in any
+// order, and a target only needs records of one kind to be included.
+func groupObjects(avus []model.AVURecord, comments []model.CommentRecord, favorites []model.FavoriteRecord) []*model.ObjectRecords {
+	objects := make(map[string]*model.ObjectRecords)
+	object := func(id string) *model.ObjectRecords {
+		obj, ok := objects[id]
+		if !ok {
+			obj = &model.ObjectRecords{}
+			objects[id] = obj
 		}
+		return obj
+	}
+
+	for _, avu := range avus {
+		obj := object(avu.TargetId)
+		obj.AVUs = append(obj.AVUs, avu)
+	}
+	for _, comment := range comments {
+		obj := object(comment.TargetId)
+		obj.Comments = append(obj.Comments, comment)
 	}
-	err := o.rows.Err()
-	if err == nil && !o.anyRows {
-		log.Info("No metadata was found in the configured database.")
-		return nil, EOS
+	for _, favorite := range favorites {
+		obj := object(favorite.TargetId)
+		obj.Favorites = append(obj.Favorites, favorite)
 	}
-	return retval, err
+
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	retval := make([]*model.ObjectRecords, 0, len(ids))
+	for _, id := range ids {
+		obj := objects[id]
+		obj.SetTarget(id)
+		retval = append(retval, obj)
+	}
+	return retval
 }
 
+// GetObjects returns the AVUs, comments, and favorites for each of the given targets, keyed by target ID. The IDs
+// should be in the canonical lowercase form. Every ID has an entry, even if the target has no records.
+func (d *Databaser) GetObjects(ctx context.Context, uuids []string) (map[string]*model.ObjectRecords, error) {
+	ctx, q := startQuery(ctx, "GetObjects")
+	defer q.end()
+
+	avus, comments, favorites, err := d.objectRecords(ctx, q, uuids)
+	if err != nil {
+		return nil, q.fail(err)
+	}
+
+	templates := make(map[string]*model.Template)
+	templateIDs := make(map[string]bool)
+	for _, avu := range avus {
+		if avu.TemplateID != "" {
+			templateIDs[avu.TemplateID] = true
+		}
+	}
+	if len(templateIDs) > 0 {
+		var idList []string
+		for id := range templateIDs {
+			idList = append(idList, id)
+		}
+		if templates, err = d.GetTemplateDefinitions(ctx, idList...); err != nil {
+			return nil, q.fail(err)
+		}
+	}
+
+	ontologies := d.Ontologies()
+	retval := make(map[string]*model.ObjectRecords, len(uuids))
+	for _, obj := range groupObjects(avus, comments, favorites) {
+		retval[obj.ID] = obj
+	}
+	for _, id := range uuids {
+		if _, ok := retval[id]; !ok {
+			retval[id] = &model.ObjectRecords{}
+			retval[id].SetTarget(id)
+		}
+	}
+	for _, obj := range retval {
+		obj.Templates = appliedTemplates(obj.AVUs, templates)
+		obj.Ontologies = ontologies
+	}
+	return retval, nil
+}
+
+const _selectTemplateTargets = `
+	WITH RECURSIVE template_avus AS (
+	SELECT avus.target_id,
+	       avus.target_type
+	  FROM %[1]s.avus
+	  JOIN %[1]s.template_instances ti ON (ti.avu_id = avus.id)
+	 WHERE ti.template_id = cast($1 as uuid)
+	UNION ALL
+	SELECT avus.target_id,
+	       avus.target_type
+	  FROM %[1]s.avus
+	  JOIN template_avus ta ON (ta.target_id = avus.id AND ta.target_type = 'avu')
+	) SELECT DISTINCT cast(target_id as varchar) FROM template_avus WHERE target_type != 'avu';
+`
+
+// GetTemplateTargets returns the IDs of the targets that have AVUs applied through the given template, including
+// AVUs nested beneath other AVUs.
+func (d *Databaser) GetTemplateTargets(ctx context.Context, templateID string) ([]string, error) {
+	ctx, q := startQuery(ctx, "GetTemplateTargets")
+	defer q.end()
+
+	query := fmt.Sprintf(_selectTemplateTargets, d.schema)
+
+	rows, err := d.db.QueryContext(ctx, query, templateID)
+	if err != nil {
+		return nil, q.fail(err)
+	}
+	defer rows.Close()
+	var retval []string
+	for rows.Next() {
+		q.rows++
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, q.fail(err)
+		}
+		retval = append(retval, id)
+	}
+	return retval, q.fail(rows.Err())
+}
+
+const _selectTemplateAttrs = `
+	SELECT cast(t.id as varchar),
+	       coalesce(t.name, ''),
+	       cast(a.id as varchar),
+	       coalesce(a.name, ''),
+	       coalesce(a.required, false),
+	       coalesce(vt.name, '')
+	  FROM %[1]s.templates t
+	  JOIN %[1]s.template_attrs ta ON (ta.template_id = t.id)
+	  JOIN %[1]s.attributes a ON (a.id = ta.attribute_id)
+	  LEFT JOIN %[1]s.value_types vt ON (vt.id = a.value_type_id)
+	  %[2]s
+	 ORDER BY t.id, ta.display_order;
+`
+
+const _selectEnumValues = `
+	SELECT cast(ev.attribute_id as varchar),
+	       ev.value
+	  FROM %[1]s.attr_enum_values ev
+	 WHERE ev.attribute_id IN (SELECT ta.attribute_id FROM %[1]s.template_attrs ta %[2]s)
+	 ORDER BY ev.attribute_id, ev.display_order;
+`
+
+// GetTemplateDefinitions returns the attribute definitions for the given templates, keyed by template ID. If no
+// template IDs are given, the definitions of every template are returned.
+func (d *Databaser) GetTemplateDefinitions(ctx context.Context, templateIDs ...string) (map[string]*model.Template, error) {
+	ctx, q := startQuery(ctx, "GetTemplateDefinitions")
+	defer q.end()
+
+	var (
+		where string
+		args  []interface{}
+	)
+	if len(templateIDs) > 0 {
+		where = "WHERE ta.template_id = ANY(cast($1 as uuid[]))"
+		args = append(args, pq.Array(templateIDs))
+	}
+
+	rows, err := d.db.QueryContext(ctx, fmt.Sprintf(_selectTemplateAttrs, d.schema, where), args...)
+	if err != nil {
+		return nil, q.fail(err)
+	}
+	defer rows.Close()
+
+	retval := make(map[string]*model.Template)
+	attrs := make(map[string][]*model.TemplateAttribute)
+	for rows.Next() {
+		q.rows++
+		var (
+			templateID, templateName string
+			attr                     model.TemplateAttribute
+		)
+		err = rows.Scan(&templateID, &templateName, &attr.ID, &attr.Name, &attr.Required, &attr.ValueType)
+		if err != nil {
+			return nil, q.fail(err)
+		}
+
+		tmpl, ok := retval[templateID]
+		if !ok {
+			tmpl = &model.Template{ID: templateID, Name: templateName}
+			retval[templateID] = tmpl
+		}
+		tmpl.Attributes = append(tmpl.Attributes, attr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, q.fail(err)
+	}
+
+	// Attributes can be shared between templates, so collect every copy of each one to receive its enum values
+	for _, tmpl := range retval {
+		for i := range tmpl.Attributes {
+			attrs[tmpl.Attributes[i].ID] = append(attrs[tmpl.Attributes[i].ID], &tmpl.Attributes[i])
+		}
+	}
+
+	enumRows, err := d.db.QueryContext(ctx, fmt.Sprintf(_selectEnumValues, d.schema, where), args...)
+	if err != nil {
+		return nil, q.fail(err)
+	}
+	defer enumRows.Close()
+
+	for enumRows.Next() {
+		q.rows++
+		var attrID, value string
+		if err = enumRows.Scan(&attrID, &value); err != nil {
+			return nil, q.fail(err)
+		}
+		for _, attr := range attrs[attrID] {
+			attr.EnumValues = append(attr.EnumValues, value)
+		}
+	}
+	return retval, q.fail(enumRows.Err())
+}
+
+// appliedTemplates returns the subset of templates that were used to apply the given AVUs
+func appliedTemplates(avus []model.AVURecord, templates map[string]*model.Template) map[string]*model.Template {
+	retval := make(map[string]*model.Template)
+	for _, avu := range avus {
+		if tmpl, ok := templates[avu.TemplateID]; ok {
+			retval[avu.TemplateID] = tmpl
+		}
+	}
+	return retval
+}
+
+// objectPageSize is the number of objects GetAllObjects reads at a time
+const objectPageSize = 1000
+
+// Each part of the union is limited on its own so that it can be read from the target_id index. Together they contain
+// the first page of targets, whichever kinds of records the targets have.
+const _selectTargetPage = `
+	SELECT cast(target_id as varchar) FROM (
+	       (SELECT DISTINCT target_id FROM %[1]s.avus WHERE %[2]s ORDER BY target_id LIMIT %[3]s)
+	 UNION (SELECT DISTINCT target_id FROM %[1]s.comments WHERE NOT deleted AND NOT retracted AND %[2]s ORDER BY target_id LIMIT %[3]s)
+	 UNION (SELECT DISTINCT target_id FROM %[1]s.favorites WHERE %[2]s ORDER BY target_id LIMIT %[3]s)
+	) targets
+	 ORDER BY targets.target_id
+	 LIMIT %[3]s;
+`
+
+// targetPageQuery returns the query for the IDs of the next size targets matched by filter that come after the target
+// with the ID after, or the first ones if after is empty, along with the arguments bound to its placeholders. UUIDs
+// sort in the same order as their canonical strings.
+func targetPageQuery(schema string, filter *ObjectFilter, after string, size int) (string, []interface{}) {
+	condition, args := filter.targetCondition(schema)
+
+	var conditions []string
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if after != "" {
+		args = append(args, after)
+		conditions = append(conditions, fmt.Sprintf("target_id > cast($%d as uuid)", len(args)))
+	}
+	if len(conditions) == 0 {
+		conditions = append(conditions, "true")
+	}
+	args = append(args, size)
+
+	return fmt.Sprintf(_selectTargetPage, schema, strings.Join(conditions, " AND "), fmt.Sprintf("$%d", len(args))), args
+}
+
+// objectCursor reads objects a page at a time, so that no query is left open while the caller works through a page
+// or the read throttle pauses.
+type objectCursor struct {
+	ctx        context.Context
+	query      *querySpan
+	d          *Databaser
+	filter     *ObjectFilter
+	templates  map[string]*model.Template
+	ontologies *model.OntologyHierarchy
+
+	page    []*model.ObjectRecords
+	after   string
+	done    bool
+	anyRows bool
+}
+
+// nextPage reads the records of the next page of targets
+func (o *objectCursor) nextPage() error {
+	query, args := targetPageQuery(o.d.schema, o.filter, o.after, objectPageSize)
+	ids, err := queryRecords(o.ctx, o.d, scanString, query, args...)
+	if err != nil {
+		return err
+	}
+	if len(ids) < objectPageSize {
+		o.done = true
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	o.after = ids[len(ids)-1]
+
+	avus, comments, favorites, err := o.d.objectRecords(o.ctx, o.query, ids)
+	if err != nil {
+		return err
+	}
+	o.page = groupObjects(avus, comments, favorites)
+	return nil
+}
+
+// scanString reads a row with a single string column
+func scanString(row *sql.Rows) (*string, error) {
+	var s string
+	err := row.Scan(&s)
+	return &s, err
+}
+
+// Next returns the records for the next object, or EOS once all objects have been read. It blocks while the rows
+// read so far are over the Databaser's read throttle.
+func (o *objectCursor) Next() (*model.ObjectRecords, error) {
+	for len(o.page) == 0 {
+		if o.done {
+			if !o.anyRows {
+				logging.ForContext(o.ctx, log).Info("No metadata was found in the configured database.")
+			}
+			return nil, EOS
+		}
+		if err := o.nextPage(); err != nil {
+			return nil, o.query.fail(err)
+		}
+	}
+	o.anyRows = true
+
+	obj := o.page[0]
+	o.page = o.page[1:]
+
+	if err := o.d.readThrottle.wait(o.ctx, len(obj.AVUs)+len(obj.Comments)+len(obj.Favorites)); err != nil {
+		return nil, o.query.fail(err)
+	}
+
+	obj.Templates = appliedTemplates(obj.AVUs, o.templates)
+	obj.Ontologies = o.ontologies
+	return obj, nil
+}
+
+// Close ends the span tracing the query, which covers the time spent reading the objects
 func (o *objectCursor) Close() {
-	o.rows.Close()
+	o.query.end()
 }
 
-// GetAllObjects returns a function to iterate through individual objects' worth of AVURecords, and a function to clean up
-// The function it returns will return nil if all records have been read.
-func (d *Databaser) GetAllObjects(ctx context.Context) (*objectCursor, error) {
-	query := selectAVUsWhere(d.schema, "")
+// GetAllObjects returns a cursor to iterate through individual objects' worth of AVUs, comments, and favorites,
+// including objects with comments or favorites but no AVUs. The cursor's Next method will return EOS once all records
+// have been read, and the cursor must be closed when done. A nil or empty filter includes every object; since filters
+// match AVUs, a filtered cursor only returns objects with AVUs. Objects are read in pages of objectPageSize, so the
+// read throttle only pauses between queries.
+func (d *Databaser) GetAllObjects(ctx context.Context, filter *ObjectFilter) (_ *objectCursor, err error) {
+	ctx, q := startQuery(ctx, "GetAllObjects")
+	defer func() {
+		// Once the cursor is returned, closing it ends the span
+		if err != nil {
+			q.fail(err)
+			q.end()
+		}
+	}()
 
-	rows, err := d.db.QueryContext(ctx, query)
+	templates, err := d.GetTemplateDefinitions(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return newObjectCursor(rows), nil
+	return &objectCursor{
+		ctx:        ctx,
+		query:      q,
+		d:          d,
+		filter:     filter,
+		templates:  templates,
+		ontologies: d.Ontologies(),
+	}, nil
 }
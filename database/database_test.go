@@ -0,0 +1,144 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyverse-de/templeton/model"
+)
+
+func TestTargetPageQuery(t *testing.T) {
+	const after = "0b1c1d0e-98b4-4d32-9d37-fd7d41a5a2b9"
+
+	tests := []struct {
+		name      string
+		filter    *ObjectFilter
+		after     string
+		condition string
+		limit     string
+		args      []interface{}
+	}{
+		{
+			name:      "first page",
+			condition: "true ORDER BY",
+			limit:     "LIMIT $1",
+			args:      []interface{}{100},
+		},
+		{
+			name:      "later page",
+			after:     after,
+			condition: "target_id > cast($1 as uuid) ORDER BY",
+			limit:     "LIMIT $2",
+			args:      []interface{}{after, 100},
+		},
+		{
+			name:      "filtered later page",
+			filter:    &ObjectFilter{Attribute: "color"},
+			after:     after,
+			condition: "target_id IN (SELECT f.target_id FROM metadata.avus f WHERE f.attribute = $1) AND target_id > cast($2 as uuid) ORDER BY",
+			limit:     "LIMIT $3",
+			args:      []interface{}{"color", after, 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := targetPageQuery("metadata", tt.filter, tt.after, 100)
+			// Each of the three parts of the union is limited separately, as well as the whole page
+			if n := strings.Count(query, tt.condition); n != 3 {
+				t.Errorf("query has %d parts with the condition %q, want 3:\n%s", n, tt.condition, query)
+			}
+			if n := strings.Count(query, tt.limit); n != 4 {
+				t.Errorf("query has %d %q clauses, want 4:\n%s", n, tt.limit, query)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestGroupObjects(t *testing.T) {
+	avu := func(target, id string) model.AVURecord {
+		return model.AVURecord{ID: id, TargetId: target, TargetType: "file"}
+	}
+	comment := func(target, id string) model.CommentRecord {
+		return model.CommentRecord{ID: id, TargetId: target, TargetType: "folder"}
+	}
+	favorite := func(target, owner string) model.FavoriteRecord {
+		return model.FavoriteRecord{OwnerID: owner, TargetId: target, TargetType: "folder"}
+	}
+
+	// summary describes an object as its ID, its type, and the records it was given
+	summary := func(obj *model.ObjectRecords) string {
+		var records []string
+		for _, a := range obj.AVUs {
+			records = append(records, "avu:"+a.ID)
+		}
+		for _, c := range obj.Comments {
+			records = append(records, "comment:"+c.ID)
+		}
+		for _, f := range obj.Favorites {
+			records = append(records, "favorite:"+f.OwnerID)
+		}
+		return fmt.Sprintf("%s %s %s", obj.ID, obj.TargetType, strings.Join(records, ","))
+	}
+
+	tests := []struct {
+		name      string
+		avus      []model.AVURecord
+		comments  []model.CommentRecord
+		favorites []model.FavoriteRecord
+		want      []string
+	}{
+		{
+			name: "nothing",
+			want: []string{},
+		},
+		{
+			name: "only AVUs",
+			avus: []model.AVURecord{avu("a", "1"), avu("a", "2"), avu("b", "3")},
+			want: []string{"a file avu:1,avu:2", "b file avu:3"},
+		},
+		{
+			name:      "only comments and favorites",
+			comments:  []model.CommentRecord{comment("b", "1")},
+			favorites: []model.FavoriteRecord{favorite("a", "alice")},
+			want:      []string{"a folder favorite:alice", "b folder comment:1"},
+		},
+		{
+			name:      "interleaved targets",
+			avus:      []model.AVURecord{avu("a", "1"), avu("c", "2"), avu("e", "3")},
+			comments:  []model.CommentRecord{comment("b", "1"), comment("c", "2"), comment("f", "3")},
+			favorites: []model.FavoriteRecord{favorite("a", "alice"), favorite("d", "bob"), favorite("f", "carol")},
+			want: []string{
+				"a file avu:1,favorite:alice",
+				"b folder comment:1",
+				"c file avu:2,comment:2",
+				"d folder favorite:bob",
+				"e file avu:3",
+				"f folder comment:3,favorite:carol",
+			},
+		},
+		{
+			name:      "records out of order",
+			avus:      []model.AVURecord{avu("c", "1"), avu("a", "2"), avu("c", "3")},
+			favorites: []model.FavoriteRecord{favorite("b", "bob"), favorite("a", "alice")},
+			want:      []string{"a file avu:2,favorite:alice", "b folder favorite:bob", "c file avu:1,avu:3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, obj := range groupObjects(tt.avus, tt.comments, tt.favorites) {
+				got = append(got, summary(obj))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupObjects() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ObjectFilter is a type that limits the objects read by GetAllObjects. An object is included if at least one of its
+// AVUs matches every field that is set; fields left empty don't limit anything. The object's other
+// AVUs, comments, and favorites are read along with it, so that its whole document can be rebuilt. Only AVUs attached
+// directly to objects are matched, not the AVUs nested beneath them.
+type ObjectFilter struct {
+	TargetType     string     `json:"target_type,omitempty"`
+	CreatedBy      string     `json:"created_by,omitempty"`
+	ModifiedBy     string     `json:"modified_by,omitempty"`
+	Attribute      string     `json:"attribute,omitempty"`
+	ModifiedAfter  *time.Time `json:"modified_after,omitempty"`
+	ModifiedBefore *time.Time `json:"modified_before,omitempty"`
+}
+
+// IsEmpty returns whether the filter includes every object. It's safe to call on a nil filter.
+func (f *ObjectFilter) IsEmpty() bool {
+	return f == nil || *f == ObjectFilter{}
+}
+
+// targetCondition returns a condition on target_id that matches the targets of the AVUs the filter includes, and the
+// arguments bound to its placeholders. An empty filter returns an empty condition.
+func (f *ObjectFilter) targetCondition(schema string) (string, []interface{}) {
+	if f.IsEmpty() {
+		return "", nil
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.TargetType != "" {
+		add("cast(f.target_type as varchar) = $%d", f.TargetType)
+	}
+	if f.CreatedBy != "" {
+		add("f.created_by = $%d", f.CreatedBy)
+	}
+	if f.ModifiedBy != "" {
+		add("f.modified_by = $%d", f.ModifiedBy)
+	}
+	if f.Attribute != "" {
+		add("f.attribute = $%d", f.Attribute)
+	}
+	if f.ModifiedAfter != nil {
+		add("f.modified_on >= $%d", *f.ModifiedAfter)
+	}
+	if f.ModifiedBefore != nil {
+		add("f.modified_on < $%d", *f.ModifiedBefore)
+	}
+
+	return fmt.Sprintf(
+		"target_id IN (SELECT f.target_id FROM %s.avus f WHERE %s)",
+		schema, strings.Join(conditions, " AND "),
+	), args
+}
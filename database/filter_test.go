@@ -0,0 +1,73 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTargetCondition(t *testing.T) {
+	after := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		filter    *ObjectFilter
+		condition string
+		args      []interface{}
+	}{
+		{
+			name: "nil filter",
+		},
+		{
+			name:   "empty filter",
+			filter: &ObjectFilter{},
+		},
+		{
+			name:      "single field",
+			filter:    &ObjectFilter{Attribute: "color"},
+			condition: "target_id IN (SELECT f.target_id FROM metadata.avus f WHERE f.attribute = $1)",
+			args:      []interface{}{"color"},
+		},
+		{
+			name:      "target type is compared as text",
+			filter:    &ObjectFilter{TargetType: "file"},
+			condition: "target_id IN (SELECT f.target_id FROM metadata.avus f WHERE cast(f.target_type as varchar) = $1)",
+			args:      []interface{}{"file"},
+		},
+		{
+			name:   "time range",
+			filter: &ObjectFilter{ModifiedAfter: &after, ModifiedBefore: &before},
+			condition: "target_id IN (SELECT f.target_id FROM metadata.avus f " +
+				"WHERE f.modified_on >= $1 AND f.modified_on < $2)",
+			args: []interface{}{after, before},
+		},
+		{
+			name: "every field",
+			filter: &ObjectFilter{
+				TargetType:     "folder",
+				CreatedBy:      "alice",
+				ModifiedBy:     "bob",
+				Attribute:      "color",
+				ModifiedAfter:  &after,
+				ModifiedBefore: &before,
+			},
+			condition: "target_id IN (SELECT f.target_id FROM metadata.avus f " +
+				"WHERE cast(f.target_type as varchar) = $1 AND f.created_by = $2 AND f.modified_by = $3 " +
+				"AND f.attribute = $4 AND f.modified_on >= $5 AND f.modified_on < $6)",
+			args: []interface{}{"folder", "alice", "bob", "color", after, before},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, args := tt.filter.targetCondition("metadata")
+			if condition != tt.condition {
+				t.Errorf("condition = %q, want %q", condition, tt.condition)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
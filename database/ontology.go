@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/model"
+)
+
+const _selectOntologyClasses = `
+	SELECT c.iri,
+	       coalesce(c.label, '')
+	  FROM %[1]s.ontology_classes c
+	  JOIN %[1]s.ontologies o ON (o.version = c.ontology_version)
+	 WHERE NOT o.deleted
+	 ORDER BY c.iri, o.version;
+`
+
+const _selectOntologyHierarchies = `
+	SELECT h.class_iri,
+	       h.parent_iri
+	  FROM %[1]s.ontology_hierarchies h
+	  JOIN %[1]s.ontologies o ON (o.version = h.ontology_version)
+	 WHERE NOT o.deleted
+	 ORDER BY h.class_iri, h.parent_iri, o.version;
+`
+
+// LoadOntologies reads the classes and hierarchies of every non-deleted ontology from the database and replaces the
+// cached copy returned by Ontologies.
+func (d *Databaser) LoadOntologies(ctx context.Context) error {
+	ctx, q := startQuery(ctx, "LoadOntologies")
+	defer q.end()
+
+	hierarchy := model.NewOntologyHierarchy()
+
+	rows, err := d.db.QueryContext(ctx, fmt.Sprintf(_selectOntologyClasses, d.schema))
+	if err != nil {
+		return q.fail(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		q.rows++
+		var iri, label string
+		if err = rows.Scan(&iri, &label); err != nil {
+			return q.fail(err)
+		}
+		hierarchy.AddClass(iri, label)
+	}
+	if err = rows.Err(); err != nil {
+		return q.fail(err)
+	}
+
+	hierarchyRows, err := d.db.QueryContext(ctx, fmt.Sprintf(_selectOntologyHierarchies, d.schema))
+	if err != nil {
+		return q.fail(err)
+	}
+	defer hierarchyRows.Close()
+	for hierarchyRows.Next() {
+		q.rows++
+		var classIRI, parentIRI string
+		if err = hierarchyRows.Scan(&classIRI, &parentIRI); err != nil {
+			return q.fail(err)
+		}
+		hierarchy.AddParent(classIRI, parentIRI)
+	}
+	if err = hierarchyRows.Err(); err != nil {
+		return q.fail(err)
+	}
+
+	d.ontologiesMutex.Lock()
+	d.ontologies = hierarchy
+	d.ontologiesMutex.Unlock()
+
+	logging.ForContext(ctx, log).Infof("Loaded %d ontology classes", hierarchy.Len())
+	return nil
+}
+
+// Ontologies returns the cached ontology hierarchy, or nil if it hasn't been loaded.
+func (d *Databaser) Ontologies() *model.OntologyHierarchy {
+	d.ontologiesMutex.RLock()
+	defer d.ontologiesMutex.RUnlock()
+	return d.ontologies
+}
+
+// RefreshOntologies calls LoadOntologies every interval until the context is cancelled. Errors are logged and the
+// previously loaded hierarchy is kept.
+func (d *Databaser) RefreshOntologies(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.LoadOntologies(ctx); err != nil {
+				logging.ForContext(ctx, log).Errorf("Error refreshing ontologies: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/metrics"
+	"github.com/cyverse-de/templeton/throttle"
+)
+
+// The replay timestamp doesn't advance while a replica has nothing to replay, so a replica that has caught up is
+// treated as having no lag.
+const _selectReplicaLag = `
+	SELECT CASE
+	         WHEN NOT pg_is_in_recovery() THEN 0
+	         WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	         ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+	       END;
+`
+
+// Templeton's connections all share an application name, so they can be left out of the count.
+const _selectActiveConnections = `
+	SELECT count(*)
+	  FROM pg_stat_activity
+	 WHERE state = 'active'
+	   AND datname = current_database()
+	   AND application_name <> current_setting('application_name');
+`
+
+// ReadThrottleConfig is a type that contains the limits on the rows read by GetAllObjects, so that long reads such as
+// full reindexes leave room for the database's other clients. Zero values disable the corresponding limit.
+type ReadThrottleConfig struct {
+	RowsPerSecond float64
+	// Reading pauses while the database is a replica lagging behind by more than MaxReplicaLag, or while more than
+	// MaxActiveConnections connections from other clients are running queries in the database. Connections from
+	// templeton, including the ones streaming the rows, aren't counted.
+	MaxReplicaLag        time.Duration
+	MaxActiveConnections int
+	// LoadCheckInterval is how often the replica lag and active connections are checked, and how long to wait before
+	// checking again while paused.
+	LoadCheckInterval time.Duration
+}
+
+// readThrottle is a type that holds back the rows read by GetAllObjects according to a ReadThrottleConfig
+type readThrottle struct {
+	d      *Databaser
+	config ReadThrottleConfig
+	rows   *throttle.Limiter
+
+	mutex     sync.Mutex
+	lastCheck time.Time
+}
+
+// SetReadThrottle limits the rows read by the cursors returned from GetAllObjects
+func (d *Databaser) SetReadThrottle(config ReadThrottleConfig) {
+	d.readThrottle = &readThrottle{d: d, config: config, rows: throttle.NewLimiter(config.RowsPerSecond)}
+}
+
+// replicaLag returns how far behind its primary the database is, or zero if it isn't a replica
+func (d *Databaser) replicaLag(ctx context.Context) (time.Duration, error) {
+	ctx, q := startQuery(ctx, "ReplicaLag")
+	defer q.end()
+
+	var seconds float64
+	if err := d.db.QueryRowContext(ctx, _selectReplicaLag).Scan(&seconds); err != nil {
+		return 0, q.fail(err)
+	}
+	q.rows++
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// activeConnections returns the number of connections from clients other than templeton that are running queries in
+// the database
+func (d *Databaser) activeConnections(ctx context.Context) (int, error) {
+	ctx, q := startQuery(ctx, "ActiveConnections")
+	defer q.end()
+
+	var count int
+	if err := d.db.QueryRowContext(ctx, _selectActiveConnections).Scan(&count); err != nil {
+		return 0, q.fail(err)
+	}
+	q.rows++
+	return count, nil
+}
+
+// busy returns why reading should pause, or an empty string if it shouldn't. Errors are only logged, since the
+// checks shouldn't stop reads that would otherwise succeed.
+func (t *readThrottle) busy(ctx context.Context) string {
+	if t.config.MaxReplicaLag > 0 {
+		lag, err := t.d.replicaLag(ctx)
+		if err != nil {
+			logging.ForContext(ctx, log).Warnf("Error checking replica lag: %s", err)
+		} else if lag > t.config.MaxReplicaLag {
+			return fmt.Sprintf("replica lag is %s", lag.Round(time.Millisecond))
+		}
+	}
+
+	if t.config.MaxActiveConnections > 0 {
+		count, err := t.d.activeConnections(ctx)
+		if err != nil {
+			logging.ForContext(ctx, log).Warnf("Error counting active connections: %s", err)
+		} else if count > t.config.MaxActiveConnections {
+			return fmt.Sprintf("%d connections from other clients are active", count)
+		}
+	}
+	return ""
+}
+
+// waitForLoad blocks while the database is too busy, checking again every LoadCheckInterval, until it isn't or the
+// context is cancelled. The load is only checked once per LoadCheckInterval.
+func (t *readThrottle) waitForLoad(ctx context.Context) error {
+	if t.config.LoadCheckInterval <= 0 || (t.config.MaxReplicaLag <= 0 && t.config.MaxActiveConnections <= 0) {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if time.Since(t.lastCheck) < t.config.LoadCheckInterval {
+		return nil
+	}
+
+	paused := false
+	defer func() {
+		if paused {
+			metrics.DBReadsPaused.Set(0)
+			logging.ForContext(ctx, log).Info("Resuming database reads.")
+		}
+	}()
+
+	for {
+		t.lastCheck = time.Now()
+		reason := t.busy(ctx)
+		if reason == "" {
+			return nil
+		}
+		if !paused {
+			paused = true
+			metrics.DBReadsPaused.Set(1)
+			logging.ForContext(ctx, log).Warnf("Pausing database reads: %s", reason)
+		}
+
+		timer := time.NewTimer(t.config.LoadCheckInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// wait blocks until n rows are allowed to be read, or until the context is cancelled. It's safe to call on a nil
+// throttle.
+func (t *readThrottle) wait(ctx context.Context, n int) error {
+	if t == nil {
+		return nil
+	}
+	if err := t.waitForLoad(ctx); err != nil {
+		return err
+	}
+	return t.rows.Wait(ctx, n)
+}
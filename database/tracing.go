@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cyverse-de/templeton/metrics"
+)
+
+const otelName = "github.com/cyverse-de/templeton/database"
+
+// querySpan is a type that traces and times a single Databaser query, recording the number of rows it read
+type querySpan struct {
+	span    trace.Span
+	observe func()
+	rows    int
+}
+
+// startQuery starts tracing and timing the named query. The returned context should be used to run the query, and
+// end must be called once its rows have been read.
+func startQuery(ctx context.Context, name string) (context.Context, *querySpan) {
+	ctx, span := otel.Tracer(otelName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(attribute.String("db.query.name", name))
+	return ctx, &querySpan{span: span, observe: metrics.ObserveQuery(name)}
+}
+
+// fail records err on the span if it isn't nil, and returns it
+func (q *querySpan) fail(err error) error {
+	if err != nil {
+		q.span.RecordError(err)
+		q.span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// end records the row count and the query's latency, and ends the span
+func (q *querySpan) end() {
+	q.observe()
+	q.span.SetAttributes(attribute.Int("db.rows", q.rows))
+	q.span.End()
+}
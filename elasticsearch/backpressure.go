@@ -0,0 +1,252 @@
+package elasticsearch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/metrics"
+	"github.com/cyverse-de/templeton/throttle"
+)
+
+// How the bulk request rate adapts to the load on the cluster
+const (
+	// throttleMinFraction is the smallest fraction of the maximum rate the throttle slows down to
+	throttleMinFraction = 1.0 / 64
+	// throttleRampStep is the fraction of the maximum rate added back after each bulk request that isn't rejected
+	throttleRampStep = 0.05
+	// throttleCooldown keeps the rejections of requests sent at about the same time from slowing down more than once
+	throttleCooldown = time.Second
+	// throttleWindow is how far back requests are counted to measure the rate when there's no maximum
+	throttleWindow = 10 * time.Second
+)
+
+// rejectionPools are the thread pools whose rejections show that the cluster is overloaded. Bulk requests go through
+// the bulk pool, which is called write in later versions, and users feel rejections in the search pool.
+var rejectionPools = []string{"bulk", "write", "search"}
+
+// ThrottleConfig is a type that contains the limits on the bulk requests sent while reindexing. A maximum of zero
+// means no limit until the cluster pushes back.
+type ThrottleConfig struct {
+	MaxRequestsPerSecond float64
+	MaxBytesPerSecond    float64
+	// RejectionCheckInterval is how often the cluster's thread pool rejections are checked. Zero disables the check.
+	RejectionCheckInterval time.Duration
+}
+
+// bulkThrottle is a type that limits the rate of bulk requests and their size in bytes. It slows down whenever the
+// cluster rejects requests or its thread pool rejections rise, and ramps back up to the maximum while it doesn't.
+type bulkThrottle struct {
+	es       *elastic.Client
+	config   ThrottleConfig
+	requests *throttle.Limiter
+	bytes    *throttle.Limiter
+
+	mutex sync.Mutex
+	// fraction is the fraction of the ceilings currently allowed
+	fraction float64
+	// The ceilings are the configured maximums, or the rates measured when the cluster pushed back at the full rate if
+	// there are none
+	requestCeiling float64
+	bytesCeiling   float64
+	lastSlowdown   time.Time
+
+	// sent holds the requests sent in the last throttleWindow since measureStart, for measuring the rate. Measuring
+	// starts over whenever the rate has fully recovered, so that requests held back by the throttle aren't counted.
+	sent         []sentRequest
+	measureStart time.Time
+
+	lastCheck time.Time
+	rejected  int64
+}
+
+// sentRequest is a type that records when a bulk request was sent and its size in bytes
+type sentRequest struct {
+	at   time.Time
+	size int64
+}
+
+func newBulkThrottle(es *elastic.Client, config ThrottleConfig) *bulkThrottle {
+	t := &bulkThrottle{
+		es:             es,
+		config:         config,
+		requests:       throttle.NewLimiter(config.MaxRequestsPerSecond),
+		bytes:          throttle.NewLimiter(config.MaxBytesPerSecond),
+		fraction:       1,
+		requestCeiling: config.MaxRequestsPerSecond,
+		bytesCeiling:   config.MaxBytesPerSecond,
+		measureStart:   time.Now(),
+		rejected:       -1,
+	}
+	metrics.BulkThrottleFraction.Set(1)
+	return t
+}
+
+// SetThrottle limits the bulk requests sent while reindexing, and slows them down when the cluster is overloaded
+func (e *Elasticer) SetThrottle(config ThrottleConfig) {
+	e.throttle = newBulkThrottle(e.es, config)
+}
+
+// wait blocks until a bulk request of the given size is allowed to be sent, or until the context is cancelled. It's
+// safe to call on a nil throttle.
+func (t *bulkThrottle) wait(ctx context.Context, size int64) error {
+	if t == nil {
+		return nil
+	}
+	t.checkRejections(ctx)
+
+	if err := t.requests.Wait(ctx, 1); err != nil {
+		return err
+	}
+	if err := t.bytes.Wait(ctx, int(size)); err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	t.prune(now)
+	t.sent = append(t.sent, sentRequest{at: now, size: size})
+	return nil
+}
+
+// prune drops the requests sent before the last throttleWindow. The mutex must be held.
+func (t *bulkThrottle) prune(now time.Time) {
+	cutoff := now.Add(-throttleWindow)
+	i := 0
+	for i < len(t.sent) && t.sent[i].at.Before(cutoff) {
+		i++
+	}
+	t.sent = t.sent[i:]
+}
+
+// measure returns the rates of the requests and bytes sent in the last throttleWindow, or in the time since measuring
+// started if that's shorter. The mutex must be held.
+func (t *bulkThrottle) measure(now time.Time) (requests, bytes float64) {
+	t.prune(now)
+	elapsed := min(now.Sub(t.measureStart), throttleWindow).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	var total int64
+	for _, r := range t.sent {
+		total += r.size
+	}
+	return float64(len(t.sent)) / elapsed, float64(total) / elapsed
+}
+
+// apply sets the limiters to the current fraction of the ceilings. The mutex must be held.
+func (t *bulkThrottle) apply() {
+	metrics.BulkThrottleFraction.Set(t.fraction)
+
+	// Without a maximum, the limit comes off again once the rate has fully recovered, and the rate is measured afresh
+	// for the next time the cluster pushes back.
+	if t.fraction >= 1 && t.config.MaxRequestsPerSecond <= 0 {
+		t.requestCeiling = 0
+	}
+	if t.fraction >= 1 && t.config.MaxBytesPerSecond <= 0 {
+		t.bytesCeiling = 0
+	}
+	if t.fraction >= 1 && (t.config.MaxRequestsPerSecond <= 0 || t.config.MaxBytesPerSecond <= 0) {
+		t.sent = nil
+		t.measureStart = time.Now()
+	}
+	t.requests.SetRate(t.requestCeiling * t.fraction)
+	t.bytes.SetRate(t.bytesCeiling * t.fraction)
+}
+
+// slowDown halves the allowed rate, unless it was already slowed down in the last throttleCooldown. It's safe to call
+// on a nil throttle.
+func (t *bulkThrottle) slowDown(ctx context.Context, reason string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.lastSlowdown) < throttleCooldown {
+		return
+	}
+	t.lastSlowdown = now
+
+	// Without a maximum, the recent rate is the one the cluster couldn't keep up with.
+	requestRate, byteRate := t.measure(now)
+	if t.requestCeiling <= 0 && requestRate > 0 {
+		t.requestCeiling = requestRate
+	}
+	if t.bytesCeiling <= 0 && byteRate > 0 {
+		t.bytesCeiling = byteRate
+	}
+
+	t.fraction = max(t.fraction/2, throttleMinFraction)
+	t.apply()
+	logging.ForContext(ctx, log).Warnf(
+		"Slowing bulk requests to %.1f requests and %.0f bytes per second: %s",
+		t.requests.Rate(), t.bytes.Rate(), reason,
+	)
+}
+
+// speedUp raises the allowed rate a step back towards the ceilings. It's safe to call on a nil throttle.
+func (t *bulkThrottle) speedUp(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.fraction >= 1 {
+		return
+	}
+	t.fraction = min(t.fraction+throttleRampStep, 1)
+	t.apply()
+	if t.fraction >= 1 {
+		logging.ForContext(ctx, log).Info("Bulk requests are back to their full rate.")
+	}
+}
+
+// checkRejections slows down if the cluster's thread pools have rejected more requests since the last check. Errors
+// reading the stats are only logged, since they shouldn't hold up reindexing.
+func (t *bulkThrottle) checkRejections(ctx context.Context) {
+	if t.config.RejectionCheckInterval <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	due := time.Since(t.lastCheck) >= t.config.RejectionCheckInterval
+	if due {
+		t.lastCheck = time.Now()
+	}
+	t.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	stats, err := t.es.NodesStats().Metric("thread_pool").Do(ctx)
+	if err != nil {
+		logging.ForContext(ctx, log).Debugf("Error reading thread pool stats: %s", err)
+		return
+	}
+
+	var rejected int64
+	for _, node := range stats.Nodes {
+		for _, name := range rejectionPools {
+			if pool, ok := node.ThreadPool[name]; ok && pool != nil {
+				rejected += pool.Rejected
+			}
+		}
+	}
+
+	t.mutex.Lock()
+	previous := t.rejected
+	t.rejected = rejected
+	t.mutex.Unlock()
+
+	// The first check only records where the counts start from. They also go down when nodes restart.
+	if previous >= 0 && rejected > previous {
+		t.slowDown(ctx, "the cluster's thread pool rejections rose")
+	}
+}
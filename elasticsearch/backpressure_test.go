@@ -0,0 +1,147 @@
+package elasticsearch
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSlowDown(t *testing.T) {
+	bt := newBulkThrottle(nil, ThrottleConfig{MaxRequestsPerSecond: 64, MaxBytesPerSecond: 6400})
+
+	want := 1.0
+	for i := 0; i < 10; i++ {
+		// Each call comes after the cooldown, so each one halves the rate until it reaches the floor
+		bt.lastSlowdown = time.Time{}
+		bt.slowDown(context.Background(), "test")
+		want = max(want/2, throttleMinFraction)
+		if bt.fraction != want {
+			t.Fatalf("fraction = %f after %d slowdowns, want %f", bt.fraction, i+1, want)
+		}
+	}
+	if bt.fraction != throttleMinFraction {
+		t.Errorf("fraction = %f, want the floor of %f", bt.fraction, throttleMinFraction)
+	}
+	if got := bt.requests.Rate(); got != 1 {
+		t.Errorf("request rate = %f, want 1", got)
+	}
+	if got := bt.bytes.Rate(); got != 100 {
+		t.Errorf("byte rate = %f, want 100", got)
+	}
+}
+
+func TestSlowDownCooldown(t *testing.T) {
+	bt := newBulkThrottle(nil, ThrottleConfig{MaxRequestsPerSecond: 64})
+
+	bt.slowDown(context.Background(), "test")
+	bt.slowDown(context.Background(), "test")
+	if bt.fraction != 0.5 {
+		t.Errorf("fraction = %f after two slowdowns within the cooldown, want 0.5", bt.fraction)
+	}
+
+	bt.lastSlowdown = time.Now().Add(-throttleCooldown)
+	bt.slowDown(context.Background(), "test")
+	if bt.fraction != 0.25 {
+		t.Errorf("fraction = %f after a slowdown past the cooldown, want 0.25", bt.fraction)
+	}
+}
+
+func TestSpeedUp(t *testing.T) {
+	bt := newBulkThrottle(nil, ThrottleConfig{MaxRequestsPerSecond: 64, MaxBytesPerSecond: 6400})
+	bt.slowDown(context.Background(), "test")
+
+	steps := 0
+	for bt.fraction < 1 {
+		if steps++; steps > 100 {
+			t.Fatalf("fraction = %f after %d steps, want it to have reached 1", bt.fraction, steps)
+		}
+		previous := bt.fraction
+		bt.speedUp(context.Background())
+		if bt.fraction <= previous {
+			t.Fatalf("fraction went from %f to %f, want it to rise", previous, bt.fraction)
+		}
+	}
+	if steps != 10 {
+		t.Errorf("took %d steps to recover from half the rate, want 10", steps)
+	}
+
+	// Speeding up at the full rate changes nothing
+	bt.speedUp(context.Background())
+	if bt.fraction != 1 {
+		t.Errorf("fraction = %f, want 1", bt.fraction)
+	}
+	if got := bt.requests.Rate(); got != 64 {
+		t.Errorf("request rate = %f, want the maximum of 64", got)
+	}
+	if got := bt.bytes.Rate(); got != 6400 {
+		t.Errorf("byte rate = %f, want the maximum of 6400", got)
+	}
+}
+
+func TestThrottleWithoutMaximum(t *testing.T) {
+	bt := newBulkThrottle(nil, ThrottleConfig{})
+	if bt.requests.Rate() != 0 || bt.bytes.Rate() != 0 {
+		t.Fatalf("rates = %f and %f without a maximum, want no limit", bt.requests.Rate(), bt.bytes.Rate())
+	}
+
+	// Twenty requests of 500 bytes over the last ten seconds
+	now := time.Now()
+	bt.measureStart = now.Add(-throttleWindow)
+	for i := 19; i >= 0; i-- {
+		bt.sent = append(bt.sent, sentRequest{at: now.Add(-time.Duration(i) * 400 * time.Millisecond), size: 500})
+	}
+
+	bt.slowDown(context.Background(), "test")
+	if bt.requestCeiling < 1.9 || bt.requestCeiling > 2.1 {
+		t.Errorf("request ceiling = %f, want the measured rate of about 2", bt.requestCeiling)
+	}
+	if bt.bytesCeiling < 950 || bt.bytesCeiling > 1050 {
+		t.Errorf("bytes ceiling = %f, want the measured rate of about 1000", bt.bytesCeiling)
+	}
+	if got, want := bt.requests.Rate(), bt.requestCeiling/2; got != want {
+		t.Errorf("request rate = %f, want half the ceiling, %f", got, want)
+	}
+
+	for bt.fraction < 1 {
+		bt.speedUp(context.Background())
+	}
+	if bt.requestCeiling != 0 || bt.bytesCeiling != 0 {
+		t.Errorf("ceilings = %f and %f after recovering, want them cleared", bt.requestCeiling, bt.bytesCeiling)
+	}
+	if bt.requests.Rate() != 0 || bt.bytes.Rate() != 0 {
+		t.Errorf("rates = %f and %f after recovering, want no limit", bt.requests.Rate(), bt.bytes.Rate())
+	}
+	if len(bt.sent) != 0 {
+		t.Errorf("%d sent requests are still counted after recovering, want the measurement to start over", len(bt.sent))
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	bt := newBulkThrottle(nil, ThrottleConfig{})
+	now := time.Now()
+	bt.measureStart = now.Add(-time.Minute)
+	bt.sent = []sentRequest{
+		{at: now.Add(-time.Minute), size: 1000},
+		{at: now.Add(-throttleWindow - time.Second), size: 1000},
+		{at: now.Add(-5 * time.Second), size: 300},
+		{at: now.Add(-time.Second), size: 200},
+	}
+
+	requests, bytes := bt.measure(now)
+	if len(bt.sent) != 2 {
+		t.Errorf("%d requests left after measuring, want the 2 inside the window", len(bt.sent))
+	}
+	if want := 2 / throttleWindow.Seconds(); requests != want {
+		t.Errorf("request rate = %f, want %f", requests, want)
+	}
+	if want := 500 / throttleWindow.Seconds(); bytes != want {
+		t.Errorf("byte rate = %f, want %f", bytes, want)
+	}
+
+	// Measuring only counts the time since it started, if that's shorter than the window
+	bt.measureStart = now.Add(-2 * time.Second)
+	bt.sent = bt.sent[1:]
+	if requests, _ := bt.measure(now); requests != 0.5 {
+		t.Errorf("request rate = %f two seconds after measuring started, want 0.5", requests)
+	}
+}
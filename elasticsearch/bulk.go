@@ -0,0 +1,292 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/metrics"
+)
+
+// bulkIndexer is the interface used to send the requests made while reindexing, so that other implementations can be
+// substituted, e.g. for dry runs. Implementations record the outcome of every request in the result they were created
+// with, so callers don't count documents or failures themselves.
+type bulkIndexer interface {
+	Add(r elastic.BulkableRequest)
+	Flush()
+}
+
+// timedRequest is a bulk request for a document along with the newest modification time of the object's AVUs, so
+// that the indexing lag can be recorded once the request is sent. Only requests for changes that haven't been indexed
+// before should be timed; see metrics.IndexingLag.
+type timedRequest struct {
+	elastic.BulkableRequest
+	modifiedOn time.Time
+}
+
+// bulkAction is a type that contains the parsed action line of a bulk request
+type bulkAction struct {
+	op         string
+	docType    string
+	id         string
+	size       int64
+	modifiedOn time.Time
+}
+
+// parseBulkAction reads the operation, document type and ID out of a bulk request, along with its size in bytes
+func parseBulkAction(r elastic.BulkableRequest) (*bulkAction, error) {
+	lines, err := r.Source()
+	if err != nil {
+		return nil, err
+	}
+
+	action := &bulkAction{}
+	if timed, ok := r.(*timedRequest); ok {
+		action.modifiedOn = timed.modifiedOn
+	}
+	for _, line := range lines {
+		action.size += int64(len(line)) + 1
+	}
+
+	// The first line of a bulk request is the action, e.g. {"delete":{"_index":"data","_type":"file_metadata",...}}
+	var parsed map[string]struct {
+		Type string `json:"_type"`
+		ID   string `json:"_id"`
+	}
+	if len(lines) > 0 {
+		if err = json.Unmarshal([]byte(lines[0]), &parsed); err != nil {
+			return nil, err
+		}
+	}
+	for op, meta := range parsed {
+		action.op = op
+		action.docType = meta.Type
+		action.id = meta.ID
+	}
+	return action, nil
+}
+
+// How failed bulk requests and items are retried
+const (
+	bulkRetries      = 5
+	bulkRetryMinWait = 200 * time.Millisecond
+	bulkRetryMaxWait = 30 * time.Second
+)
+
+// retryableStatus returns whether a bulk request or item that failed with the given HTTP status may succeed if it's
+// sent again, e.g. after a rejection because the cluster is busy
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryableError returns whether a bulk request that returned err may succeed if it's sent again. Errors without an
+// HTTP status, such as connection failures, are retried unless the context was cancelled.
+func retryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var esErr *elastic.Error
+	if errors.As(err, &esErr) {
+		return retryableStatus(esErr.Status)
+	}
+	return true
+}
+
+// itemReason describes why an item in a bulk response failed
+func itemReason(item *elastic.BulkResponseItem) string {
+	if item.Error == nil {
+		return fmt.Sprintf("status %d", item.Status)
+	}
+	return fmt.Sprintf("status %d: %s: %s", item.Status, item.Error.Type, item.Error.Reason)
+}
+
+// pendingRequest is a type that contains a request waiting to be sent, along with the reason its last attempt failed
+type pendingRequest struct {
+	req    elastic.BulkableRequest
+	action *bulkAction
+	reason string
+}
+
+// checkedIndexer is a bulkIndexer that sends requests to Elasticsearch and checks the outcome of each item in the
+// response. Items rejected because the cluster is busy are sent again with backoff; every other failure is recorded
+// in the result against the document's ID. Requests are held back by the throttle, which is told whether the cluster
+// pushed back. It also records the latency and failures of bulk requests and the documents written.
+type checkedIndexer struct {
+	es       *elastic.Client
+	throttle *bulkThrottle
+	ctx      context.Context
+	bulkSize int
+	result   *ReindexResult
+	backoff  elastic.Backoff
+	pending  []*pendingRequest
+	// path labels the indexing lag recorded for the documents written through this indexer
+	path string
+}
+
+func newCheckedIndexer(ctx context.Context, es *elastic.Client, throttle *bulkThrottle, bulkSize int, path string, result *ReindexResult) *checkedIndexer {
+	return &checkedIndexer{
+		es:       es,
+		throttle: throttle,
+		ctx:      ctx,
+		bulkSize: bulkSize,
+		result:   result,
+		backoff:  elastic.NewExponentialBackoff(bulkRetryMinWait, bulkRetryMaxWait),
+		path:     path,
+	}
+}
+
+// fail records a permanent failure for a request
+func (c *checkedIndexer) fail(p *pendingRequest, reason string) {
+	metrics.BulkItemFailures.WithLabelValues(p.action.docType).Inc()
+	c.result.AddItemFailure(p.action.id, fmt.Errorf("error sending %s of %s/%s: %s", p.action.op, p.action.docType, p.action.id, reason))
+}
+
+// send sends one bulk request, records the items that succeeded or failed permanently, and returns the ones that
+// should be retried
+func (c *checkedIndexer) send(ctx context.Context, batch []*pendingRequest) []*pendingRequest {
+	service := c.es.Bulk()
+	for _, p := range batch {
+		service.Add(p.req)
+	}
+
+	if err := c.throttle.wait(ctx, service.EstimatedSizeInBytes()); err != nil {
+		for _, p := range batch {
+			c.fail(p, fmt.Sprintf("stopped before sending: %s", err))
+		}
+		return nil
+	}
+
+	start := time.Now()
+	resp, err := service.Do(ctx)
+	metrics.BulkRequestDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.BulkRequestFailures.Inc()
+		if retryableError(ctx, err) {
+			c.throttle.slowDown(ctx, err.Error())
+			for _, p := range batch {
+				p.reason = err.Error()
+			}
+			return batch
+		}
+		for _, p := range batch {
+			c.fail(p, err.Error())
+		}
+		return nil
+	}
+
+	var (
+		retry []*pendingRequest
+		lags  []time.Duration
+	)
+	written := time.Now()
+	for i, p := range batch {
+		// Each item in the response is a map with a single entry, keyed by the operation
+		var item *elastic.BulkResponseItem
+		if i < len(resp.Items) {
+			for _, v := range resp.Items[i] {
+				item = v
+			}
+		}
+
+		switch {
+		case item == nil:
+			c.fail(p, "missing from the bulk response")
+		case item.Status >= 200 && item.Status < 300:
+			if p.action.op == "delete" {
+				metrics.DocumentsDeleted.WithLabelValues(p.action.docType).Inc()
+				c.result.deleted()
+				continue
+			}
+			metrics.DocumentsIndexed.WithLabelValues(p.action.docType).Inc()
+			c.result.indexed()
+			if !p.action.modifiedOn.IsZero() {
+				lags = append(lags, written.Sub(p.action.modifiedOn))
+			}
+		case p.action.op == "delete" && item.Status == http.StatusNotFound:
+			// The document was already gone, which is what the delete was for.
+		case retryableStatus(item.Status):
+			p.reason = itemReason(item)
+			retry = append(retry, p)
+		default:
+			c.fail(p, itemReason(item))
+		}
+	}
+	metrics.ObserveIndexingLag(c.path, lags...)
+
+	if len(retry) > 0 {
+		c.throttle.slowDown(ctx, retry[0].reason)
+	} else {
+		c.throttle.speedUp(ctx)
+	}
+	return retry
+}
+
+func (c *checkedIndexer) Add(r elastic.BulkableRequest) {
+	action, err := parseBulkAction(r)
+	if err != nil {
+		c.result.addErrorf("Error encoding bulk request: %s", err)
+		return
+	}
+	c.pending = append(c.pending, &pendingRequest{req: r, action: action})
+
+	if len(c.pending) >= c.bulkSize {
+		c.Flush()
+	}
+}
+
+// Flush sends the pending requests, retrying the items that can be retried until they succeed or the retries run out
+func (c *checkedIndexer) Flush() {
+	// Sending an empty bulk request is an error, and there's nothing to do anyway.
+	if len(c.pending) == 0 {
+		return
+	}
+
+	ctx, span := otel.Tracer(otelName).Start(c.ctx, "checkedIndexer.Flush")
+	defer span.End()
+
+	batch := c.pending
+	c.pending = nil
+	for attempt := 0; len(batch) > 0; attempt++ {
+		batch = c.send(ctx, batch)
+		if len(batch) == 0 {
+			return
+		}
+
+		if attempt >= bulkRetries {
+			for _, p := range batch {
+				c.fail(p, fmt.Sprintf("gave up after %d retries: %s", bulkRetries, p.reason))
+			}
+			return
+		}
+		wait, ok := c.backoff.Next(attempt)
+		if !ok {
+			wait = bulkRetryMaxWait
+		}
+
+		logging.ForContext(ctx, log).Warnf("Retrying %d bulk requests in %s: %s", len(batch), wait, batch[0].reason)
+		metrics.BulkItemRetries.Add(float64(len(batch)))
+		c.result.retried(len(batch))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			for _, p := range batch {
+				c.fail(p, fmt.Sprintf("stopped before retrying: %s", ctx.Err()))
+			}
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package elasticsearch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/olivere/elastic.v5"
+)
+
+// fakeRequest is a bulk request with fixed source lines
+type fakeRequest struct {
+	lines []string
+	err   error
+}
+
+func (r fakeRequest) String() string {
+	return "fake"
+}
+
+func (r fakeRequest) Source() ([]string, error) {
+	return r.lines, r.err
+}
+
+func TestParseBulkAction(t *testing.T) {
+	modifiedOn := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	index := elastic.NewBulkIndexRequest().Index("data").Type("file_metadata").Id("a").Doc(map[string]string{"k": "v"})
+
+	tests := []struct {
+		name    string
+		request elastic.BulkableRequest
+		want    *bulkAction
+		wantErr bool
+	}{
+		{
+			name:    "index",
+			request: index,
+			want: &bulkAction{
+				op:      "index",
+				docType: "file_metadata",
+				id:      "a",
+				// Each line is followed by a newline
+				size: int64(len(`{"index":{"_id":"a","_index":"data","_type":"file_metadata"}}`) + 1 + len(`{"k":"v"}`) + 1),
+			},
+		},
+		{
+			name:    "delete",
+			request: elastic.NewBulkDeleteRequest().Index("data").Type("folder_metadata").Id("b"),
+			want: &bulkAction{
+				op:      "delete",
+				docType: "folder_metadata",
+				id:      "b",
+				size:    int64(len(`{"delete":{"_id":"b","_index":"data","_type":"folder_metadata"}}`) + 1),
+			},
+		},
+		{
+			name:    "timed",
+			request: &timedRequest{BulkableRequest: index, modifiedOn: modifiedOn},
+			want: &bulkAction{
+				op:         "index",
+				docType:    "file_metadata",
+				id:         "a",
+				size:       int64(len(`{"index":{"_id":"a","_index":"data","_type":"file_metadata"}}`) + 1 + len(`{"k":"v"}`) + 1),
+				modifiedOn: modifiedOn,
+			},
+		},
+		{
+			name:    "no lines",
+			request: fakeRequest{},
+			want:    &bulkAction{},
+		},
+		{
+			name:    "source error",
+			request: fakeRequest{err: errors.New("can't encode")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid action line",
+			request: fakeRequest{lines: []string{`{"index":`}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBulkAction(tt.request)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseBulkAction() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBulkAction() returned an error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBulkAction() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
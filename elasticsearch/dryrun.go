@@ -0,0 +1,139 @@
+package elasticsearch
+
+import (
+	"context"
+	"sync"
+
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/logging"
+)
+
+// DryRunTypeStats is a type that contains the would-be operations for a single document type
+type DryRunTypeStats struct {
+	Indexed int   `json:"indexed"`
+	Deleted int   `json:"deleted"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// DryRunSummary is a type that contains the would-be operations of a dry run, by document type
+type DryRunSummary struct {
+	Types   map[string]*DryRunTypeStats `json:"types"`
+	Indexed int                         `json:"indexed"`
+	Deleted int                         `json:"deleted"`
+	Bytes   int64                       `json:"bytes"`
+}
+
+// dryRunStats is a type that accumulates the requests that would have been sent during a dry run
+type dryRunStats struct {
+	mutex sync.Mutex
+	types map[string]*DryRunTypeStats
+}
+
+func newDryRunStats() *dryRunStats {
+	return &dryRunStats{types: make(map[string]*DryRunTypeStats)}
+}
+
+func (s *dryRunStats) add(ctx context.Context, r elastic.BulkableRequest) (*bulkAction, error) {
+	action, err := parseBulkAction(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats, ok := s.types[action.docType]
+	if !ok {
+		stats = &DryRunTypeStats{}
+		s.types[action.docType] = stats
+	}
+	if action.op == "delete" {
+		stats.Deleted++
+	} else {
+		stats.Indexed++
+	}
+	stats.Bytes += action.size
+	logging.ForContext(ctx, log).WithField("entity", action.id).Debugf("Dry run: would %s %s/%s", action.op, action.docType, action.id)
+	return action, nil
+}
+
+// merge adds the requests counted in other into s
+func (s *dryRunStats) merge(other *dryRunStats) {
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for t, stats := range other.types {
+		merged, ok := s.types[t]
+		if !ok {
+			merged = &DryRunTypeStats{}
+			s.types[t] = merged
+		}
+		merged.Indexed += stats.Indexed
+		merged.Deleted += stats.Deleted
+		merged.Bytes += stats.Bytes
+	}
+}
+
+func (s *dryRunStats) summary() *DryRunSummary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	retval := &DryRunSummary{Types: make(map[string]*DryRunTypeStats)}
+	for t, stats := range s.types {
+		copied := *stats
+		retval.Types[t] = &copied
+		retval.Indexed += stats.Indexed
+		retval.Deleted += stats.Deleted
+		retval.Bytes += stats.Bytes
+	}
+	return retval
+}
+
+// dryRunIndexer is a bulkIndexer that records requests instead of sending them. Every request is counted in the
+// result as if it had succeeded.
+type dryRunIndexer struct {
+	ctx    context.Context
+	stats  *dryRunStats
+	result *ReindexResult
+}
+
+func (i *dryRunIndexer) Add(r elastic.BulkableRequest) {
+	action, err := i.stats.add(i.ctx, r)
+	if err != nil {
+		i.result.addErrorf("Error encoding bulk request: %s", err)
+		return
+	}
+	if action.op == "delete" {
+		i.result.deleted()
+	} else {
+		i.result.indexed()
+	}
+}
+
+func (i *dryRunIndexer) Flush() {}
+
+// EnableDryRun makes the bulk reindexing methods count and log the requests they would send instead of sending them
+func (e *Elasticer) EnableDryRun() {
+	e.dryRun = true
+}
+
+// DryRun returns whether dry run mode is enabled
+func (e *Elasticer) DryRun() bool {
+	return e.dryRun
+}
+
+// newIndexer returns the bulk indexer used while reindexing, which doesn't send anything in dry run mode. The outcome
+// of each request is recorded in result, along with the requests a dry run would have sent, and the path labels the
+// indexing lag metrics recorded for the documents it writes.
+func (e *Elasticer) newIndexer(ctx context.Context, bulkSize int, path string, result *ReindexResult) bulkIndexer {
+	if e.dryRun {
+		if result.dryRun == nil {
+			result.dryRun = newDryRunStats()
+		}
+		return &dryRunIndexer{ctx: ctx, stats: result.dryRun, result: result}
+	}
+	return newCheckedIndexer(ctx, e.es, e.throttle, bulkSize, path, result)
+}
@@ -4,18 +4,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 
-	"github.com/cyverse-de/esutils"
 	"gopkg.in/olivere/elastic.v5"
 
 	"context"
 
 	"github.com/cyverse-de/templeton/database"
 	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/metrics"
 	"github.com/cyverse-de/templeton/model"
 )
 
@@ -33,9 +35,15 @@ var httpClient = http.Client{Transport: otelhttp.NewTransport(http.DefaultTransp
 
 // Elasticer is a type used to interact with Elasticsearch
 type Elasticer struct {
-	es      *elastic.Client
-	baseURL string
-	index   string
+	es       *elastic.Client
+	baseURL  string
+	index    string
+	dryRun   bool
+	throttle *bulkThrottle
+
+	// lastFullReindex is when the last successful full reindex started, in Unix nanoseconds, or zero if there hasn't
+	// been one
+	lastFullReindex atomic.Int64
 }
 
 // NewElasticer returns a pointer to an Elasticer instance that has already tested its connection
@@ -50,165 +58,317 @@ func NewElasticer(elasticsearchBase string, user string, password string, elasti
 	return &Elasticer{es: c, baseURL: elasticsearchBase, index: elasticsearchIndex}, nil
 }
 
+// lagWatermark returns when the last successful full reindex started, or the zero time if there hasn't been one.
+// Objects modified since then are the only ones whose indexing lag IndexEverything records.
+func (e *Elasticer) lagWatermark() time.Time {
+	if nanos := e.lastFullReindex.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
 func (e *Elasticer) Close() {
 	e.es.Stop()
 }
 
-func (e *Elasticer) NewBulkIndexer(context context.Context, bulkSize int) *esutils.BulkIndexer {
-	return esutils.NewBulkIndexerContext(context, e.es, bulkSize)
+// Health returns an error if the cluster can't be reached or its health is red
+func (e *Elasticer) Health(ctx context.Context) error {
+	health, err := e.es.ClusterHealth().Index(e.index).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if health.Status == "red" {
+		return fmt.Errorf("cluster %s health is red", health.ClusterName)
+	}
+	return nil
 }
 
-func (e *Elasticer) PurgeType(context context.Context, d *database.Databaser, indexer *esutils.BulkIndexer, t string) error {
+// PurgeType walks every document of a type in the index, deleting those whose objects no longer have AVUs, comments,
+// or favorites. The deletes are counted in the result the indexer was created with.
+func (e *Elasticer) PurgeType(context context.Context, d *database.Databaser, indexer bulkIndexer, t string) (*ReindexResult, error) {
 	ctx, span := otel.Tracer(otelName).Start(context, "PurgeType")
 	defer span.End()
 
+	result := newReindexResult(ctx)
+	progressFrom(ctx).setPhase("purge " + t)
 	scanner := e.es.Scroll(e.index).Type(t).Scroll("1m")
 
 	for {
 		docs, err := scanner.Do(ctx)
 		if err == io.EOF {
-			log.Infof("Finished all rows for purge of %s.", t)
+			logging.ForContext(ctx, log).Infof("Finished all rows for purge of %s.", t)
 			break
 		}
 		if err != nil {
-			return err
+			return result.finish(), err
 		}
 
 		if docs.TotalHits() > 0 {
 			for _, hit := range docs.Hits.Hits {
-				avus, err := d.GetObjectAVUs(ctx, hit.Id)
+				result.scanned()
+				exists, err := d.HasRecords(ctx, hit.Id)
 				if err != nil {
-					log.Errorf("Error processing %s/%s: %s", t, hit.Id, err)
+					result.addErrorf("Error processing %s/%s: %s", t, hit.Id, err)
 					continue
 				}
-				if len(avus) == 0 {
-					log.Infof("Deleting %s/%s", t, hit.Id)
-					req := elastic.NewBulkDeleteRequest().Index(e.index).Type(t).Routing(hit.Id).Id(hit.Id)
-					err = indexer.Add(req)
-					if err != nil {
-						log.Errorf("Error enqueuing delete of %s/%s: %s", t, hit.Id, err)
-					}
+				if !exists {
+					logging.ForContext(ctx, log).WithField("entity", hit.Id).Infof("Deleting %s/%s", t, hit.Id)
+					indexer.Add(elastic.NewBulkDeleteRequest().Index(e.index).Type(t).Routing(hit.Id).Id(hit.Id))
 				}
 			}
 		}
 	}
-	return nil
+	return result.finish(), nil
 }
 
-// PurgeIndex walks an index querying a database, deleting those which should not exist
-func (e *Elasticer) PurgeIndex(context context.Context, d *database.Databaser) {
+// PurgeIndex walks an index querying a database, deleting those which should not exist. A non-nil error means the
+// purge couldn't be completed; failures for individual documents are only recorded in the result.
+func (e *Elasticer) PurgeIndex(context context.Context, d *database.Databaser) (*ReindexResult, error) {
 	ctx, span := otel.Tracer(otelName).Start(context, "PurgeIndex")
 	defer span.End()
 
-	indexer := e.NewBulkIndexer(ctx, 1000)
-	defer indexer.Flush()
+	result := newReindexResult(ctx)
+	indexer := e.newIndexer(ctx, 1000, "purge", result)
 
-	err := e.PurgeType(ctx, d, indexer, "file_metadata")
-	if err != nil {
-		log.Fatal(err)
-		return
+	for _, t := range []string{"file_metadata", "folder_metadata"} {
+		typeResult, err := e.PurgeType(ctx, d, indexer, t)
+		result.merge(typeResult)
+		if err != nil {
+			indexer.Flush()
+			return result.finish(), fmt.Errorf("error purging %s: %w", t, err)
+		}
 	}
 
-	err = e.PurgeType(ctx, d, indexer, "folder_metadata")
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
+	indexer.Flush()
+	return result.finish(), nil
 }
 
-// IndexEverything creates a bulk indexer and takes a database, and iterates to index its contents
-func (e *Elasticer) IndexEverything(context context.Context, d *database.Databaser) {
+// IndexEverything creates a bulk indexer and takes a database, and iterates to index its contents, limited to the
+// objects matched by filter if it isn't empty. A non-nil error means the objects couldn't be read; failures for
+// individual objects are only recorded in the result.
+func (e *Elasticer) IndexEverything(context context.Context, d *database.Databaser, filter *database.ObjectFilter) (*ReindexResult, error) {
 	ctx, span := otel.Tracer(otelName).Start(context, "IndexEverything")
 	defer span.End()
 
-	indexer := e.NewBulkIndexer(ctx, 1000)
-	defer indexer.Flush()
+	result := newReindexResult(ctx)
+	progressFrom(ctx).setPhase("index")
+	since := e.lagWatermark()
 
-	cursor, err := d.GetAllObjects(ctx)
+	cursor, err := d.GetAllObjects(ctx, filter)
 	if err != nil {
-		log.Fatal(err)
+		return result.finish(), fmt.Errorf("error reading objects: %w", err)
 	}
 	defer cursor.Close()
 
+	indexer := e.newIndexer(ctx, 1000, "reindex", result)
+
 	for {
-		avus, err := cursor.Next()
+		obj, err := cursor.Next()
 		if err == database.EOS {
-			log.Info("Done all rows, finishing.")
+			logging.ForContext(ctx, log).Info("Done all rows, finishing.")
 			break
 		}
 		if err != nil {
-			log.Error(err)
-			break
+			indexer.Flush()
+			return result.finish(), fmt.Errorf("error reading objects: %w", err)
 		}
+		result.scanned()
 
-		formatted, err := model.AVUsToIndexedObject(avus)
+		formatted, err := model.ObjectToIndexedObject(obj)
 		if err != nil {
-			log.Error(err)
-			break
+			result.addErrorf("Error formatting %s: %s", obj.ID, err)
+			continue
 		}
 
-		if knownTypes[avus[0].TargetType] {
-			indexedType := fmt.Sprintf("%s_metadata", avus[0].TargetType)
-			log.Infof("Indexing %s/%s", indexedType, formatted.ID)
+		if !knownTypes[obj.TargetType] {
+			result.skippedUnknownType()
+			continue
+		}
 
-			req := elastic.NewBulkIndexRequest().Index(e.index).Type(indexedType).Parent(formatted.ID).Id(formatted.ID).Doc(formatted)
-			err = indexer.Add(req)
-			if err != nil {
-				log.Error(err)
-				break
-			}
+		indexedType := fmt.Sprintf("%s_metadata", obj.TargetType)
+		logging.ForContext(ctx, log).WithField("entity", formatted.ID).Infof("Indexing %s/%s", indexedType, formatted.ID)
+
+		req := elastic.NewBulkIndexRequest().Index(e.index).Type(indexedType).Parent(formatted.ID).Id(formatted.ID).Doc(formatted)
+		if modifiedOn := obj.LastModified(); !since.IsZero() && modifiedOn.After(since) {
+			indexer.Add(&timedRequest{BulkableRequest: req, modifiedOn: modifiedOn})
+		} else {
+			indexer.Add(req)
 		}
 	}
+
+	indexer.Flush()
+	return result.finish(), nil
 }
 
-func (e *Elasticer) Reindex(context context.Context, d *database.Databaser) {
+// Reindex deletes documents that should no longer exist and then indexes everything in the database. A non-nil error
+// means the reindex stopped early.
+func (e *Elasticer) Reindex(context context.Context, d *database.Databaser) (*ReindexResult, error) {
 	ctx, span := otel.Tracer(otelName).Start(context, "Reindex")
 	defer span.End()
 
-	e.PurgeIndex(ctx, d)
-	e.IndexEverything(ctx, d)
+	result := newReindexResult(ctx)
+	purgeResult, err := e.PurgeIndex(ctx, d)
+	result.merge(purgeResult)
+	if err != nil {
+		result.addError(err)
+		return result.finish(), err
+	}
+
+	indexResult, err := e.IndexEverything(ctx, d, nil)
+	result.merge(indexResult)
+	if err != nil {
+		result.addError(err)
+		return result.finish(), err
+	}
+
+	result.finish()
+	metrics.ReindexDuration.Observe(result.DurationSeconds)
+	if result.OK() {
+		metrics.ReindexLastSuccess.SetToCurrentTime()
+		if !e.DryRun() {
+			e.lastFullReindex.Store(result.started.UnixNano())
+		}
+	}
+	return result, nil
 }
 
-func (e *Elasticer) DeleteOne(context context.Context, id string) {
+// ReindexFiltered indexes the objects matched by filter, or runs a full Reindex if the filter is empty. A filtered
+// reindex doesn't delete any documents, since objects whose AVUs have all been removed can't match a filter.
+func (e *Elasticer) ReindexFiltered(context context.Context, d *database.Databaser, filter *database.ObjectFilter) (*ReindexResult, error) {
+	if filter.IsEmpty() {
+		return e.Reindex(context, d)
+	}
+
+	ctx, span := otel.Tracer(otelName).Start(context, "ReindexFiltered")
+	defer span.End()
+
+	result, err := e.IndexEverything(ctx, d, filter)
+	if err != nil {
+		result.addError(err)
+	}
+	return result, err
+}
+
+// IndexTemplate reindexes only the targets that have AVUs applied through the given template
+func (e *Elasticer) IndexTemplate(context context.Context, d *database.Databaser, templateID string) (*ReindexResult, error) {
+	ctx, span := otel.Tracer(otelName).Start(context, "IndexTemplate")
+	defer span.End()
+
+	result := newReindexResult(ctx)
+	progressFrom(ctx).setPhase("template " + templateID)
+	ids, err := d.GetTemplateTargets(ctx, templateID)
+	if err != nil {
+		return result.finish(), fmt.Errorf("error finding targets for template %s: %w", templateID, err)
+	}
+	logging.ForContext(ctx, log).WithField("template_id", templateID).Infof("Reindexing %d targets for template %s", len(ids), templateID)
+
+	indexer := e.newIndexer(ctx, 1000, "template", result)
+
+	for _, id := range ids {
+		result.scanned()
+		obj, err := d.GetObject(ctx, id)
+		if err != nil {
+			result.addErrorf("Error processing %s: %s", id, err)
+			continue
+		}
+
+		formatted, err := model.ObjectToIndexedObject(obj)
+		if err == model.ErrNoRecords {
+			for t := range knownTypes {
+				indexer.Add(elastic.NewBulkDeleteRequest().Index(e.index).Type(fmt.Sprintf("%s_metadata", t)).Routing(id).Id(id))
+			}
+			continue
+		}
+		if err != nil {
+			result.addErrorf("Error processing %s: %s", id, err)
+			continue
+		}
+
+		if !knownTypes[obj.TargetType] {
+			result.skippedUnknownType()
+			continue
+		}
+
+		indexedType := fmt.Sprintf("%s_metadata", obj.TargetType)
+		logging.ForContext(ctx, log).WithField("entity", formatted.ID).Infof("Indexing %s/%s", indexedType, formatted.ID)
+
+		req := elastic.NewBulkIndexRequest().Index(e.index).Type(indexedType).Parent(formatted.ID).Id(formatted.ID).Doc(formatted)
+		indexer.Add(req)
+	}
+
+	indexer.Flush()
+	return result.finish(), nil
+}
+
+// DeleteOne deletes the documents for one entity from every type. Documents that don't exist are ignored.
+func (e *Elasticer) DeleteOne(context context.Context, id string) error {
 	ctx, span := otel.Tracer(otelName).Start(context, "DeleteOne")
 	defer span.End()
 
-	log.Infof("Deleting metadata for %s", id)
+	logging.ForContext(ctx, log).WithField("entity", id).Infof("Deleting metadata for %s", id)
 	_, fileErr := e.es.Delete().Index(e.index).Type("file_metadata").Parent(id).Id(id).Do(ctx)
+	if fileErr != nil && !elastic.IsNotFound(fileErr) {
+		return fmt.Errorf("error deleting file metadata for %s: %s", id, fileErr)
+	}
+	if fileErr == nil {
+		metrics.DocumentsDeleted.WithLabelValues("file_metadata").Inc()
+	}
 	_, folderErr := e.es.Delete().Index(e.index).Type("folder_metadata").Parent(id).Id(id).Do(ctx)
-	if fileErr != nil && folderErr != nil {
-		log.Errorf("Error deleting file metadata for %s: %s", id, fileErr)
-		log.Errorf("Error deleting folder metadata for %s: %s", id, folderErr)
+	if folderErr != nil && !elastic.IsNotFound(folderErr) {
+		return fmt.Errorf("error deleting folder metadata for %s: %s", id, folderErr)
 	}
+	if folderErr == nil {
+		metrics.DocumentsDeleted.WithLabelValues("folder_metadata").Inc()
+	}
+	return nil
 }
 
-// IndexOne takes a database and one ID and reindexes that one entity. It should not die or throw errors.
-func (e *Elasticer) IndexOne(context context.Context, d *database.Databaser, id string) {
+// IndexOne takes a database and one ID and reindexes that one entity. It should not die; failures are recorded in
+// the returned result.
+func (e *Elasticer) IndexOne(context context.Context, d *database.Databaser, id string) *ReindexResult {
 	ctx, span := otel.Tracer(otelName).Start(context, "IndexOne")
 	defer span.End()
 
-	avus, err := d.GetObjectAVUs(ctx, id)
+	result := newReindexResult(ctx)
+	result.scanned()
+
+	obj, err := d.GetObject(ctx, id)
 	if err != nil {
-		log.Error(err)
-		return
+		result.addErrorf("Error processing %s: %s", id, err)
+		return result.finish()
 	}
 
-	formatted, err := model.AVUsToIndexedObject(avus)
-	if err == model.ErrNoAVUs {
-		e.DeleteOne(ctx, id)
-		return
+	formatted, err := model.ObjectToIndexedObject(obj)
+	if err == model.ErrNoRecords {
+		if err = e.DeleteOne(ctx, id); err != nil {
+			result.addErrorf("%s", err)
+			return result.finish()
+		}
+		result.deleted()
+		return result.finish()
 	}
 	if err != nil {
-		log.Error(err)
-		return
+		result.addErrorf("Error formatting %s: %s", id, err)
+		return result.finish()
 	}
 
-	if knownTypes[avus[0].TargetType] {
-		indexedType := fmt.Sprintf("%s_metadata", avus[0].TargetType)
-		log.Infof("Indexing %s/%s", indexedType, formatted.ID)
-		_, err = e.es.Index().Index(e.index).Type(indexedType).Parent(formatted.ID).Id(formatted.ID).BodyJson(formatted).Do(ctx)
-		if err != nil {
-			log.Error(err)
-		}
+	if !knownTypes[obj.TargetType] {
+		result.skippedUnknownType()
+		return result.finish()
+	}
+
+	indexedType := fmt.Sprintf("%s_metadata", obj.TargetType)
+	logging.ForContext(ctx, log).WithField("entity", formatted.ID).Infof("Indexing %s/%s", indexedType, formatted.ID)
+	_, err = e.es.Index().Index(e.index).Type(indexedType).Parent(formatted.ID).Id(formatted.ID).BodyJson(formatted).Do(ctx)
+	if err != nil {
+		result.addErrorf("Error indexing %s/%s: %s", indexedType, formatted.ID, err)
+		return result.finish()
+	}
+	metrics.DocumentsIndexed.WithLabelValues(indexedType).Inc()
+	// Objects with only favorites have no modification time to measure the lag from.
+	if modifiedOn := obj.LastModified(); !modifiedOn.IsZero() {
+		metrics.ObserveIndexingLag("incremental", time.Since(modifiedOn))
 	}
+	result.indexed()
+	return result.finish()
 }
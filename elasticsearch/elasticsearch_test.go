@@ -0,0 +1,89 @@
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingCluster returns an Elasticer for a cluster that fails every request with status
+func failingCluster(t *testing.T, status int) *Elasticer {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error": {"type": "test_exception", "reason": "failing on purpose"}, "status": 500}`))
+	}))
+	t.Cleanup(server.Close)
+
+	e, err := NewElasticer(server.URL, "", "", "data")
+	if err != nil {
+		t.Fatalf("NewElasticer() returned an error: %s", err)
+	}
+	t.Cleanup(e.Close)
+	return e
+}
+
+func TestReindexErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		reindex func(e *Elasticer) (*ReindexResult, error)
+		// recorded is whether the error is also recorded in the result, rather than left to the caller
+		recorded bool
+	}{
+		{
+			name:    "PurgeIndex",
+			reindex: func(e *Elasticer) (*ReindexResult, error) { return e.PurgeIndex(context.Background(), nil) },
+		},
+		{
+			name:     "Reindex",
+			reindex:  func(e *Elasticer) (*ReindexResult, error) { return e.Reindex(context.Background(), nil) },
+			recorded: true,
+		},
+		{
+			name:     "ReindexFiltered without a filter",
+			reindex:  func(e *Elasticer) (*ReindexResult, error) { return e.ReindexFiltered(context.Background(), nil, nil) },
+			recorded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := failingCluster(t, http.StatusInternalServerError)
+
+			result, err := tt.reindex(e)
+			if err == nil {
+				t.Fatal("the error from the cluster wasn't returned")
+			}
+			if !strings.Contains(err.Error(), "error purging file_metadata") {
+				t.Errorf("error = %q, want it to say which type couldn't be purged", err)
+			}
+			if result == nil {
+				t.Fatal("no result was returned along with the error")
+			}
+			if tt.recorded && result.OK() {
+				t.Errorf("result = %s, want it not to be OK", result)
+			}
+			if !e.lagWatermark().IsZero() {
+				t.Error("a failed reindex moved the indexing lag watermark")
+			}
+		})
+	}
+}
+
+func TestReindexCancelled(t *testing.T) {
+	e := failingCluster(t, http.StatusInternalServerError)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := e.Reindex(ctx, nil)
+	if err == nil {
+		t.Fatal("Reindex() with a cancelled context didn't return an error")
+	}
+	if result == nil || result.OK() {
+		t.Errorf("result = %v, want a result that isn't OK", result)
+	}
+}
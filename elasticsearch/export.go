@@ -0,0 +1,131 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/database"
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/model"
+)
+
+const (
+	// FormatNDJSON writes one ExportedObject per line
+	FormatNDJSON = "ndjson"
+	// FormatBulk writes the action and document lines of an Elasticsearch bulk request
+	FormatBulk = "bulk"
+)
+
+// ExportedObject is a type that contains a document along with its target type, which is needed to load it back into
+// the index
+type ExportedObject struct {
+	TargetType string `json:"target_type"`
+	*model.IndexedObject
+}
+
+// ExportResult is a type that summarizes the work done by Export
+type ExportResult struct {
+	Scanned            int     `json:"scanned"`
+	Exported           int     `json:"exported"`
+	SkippedUnknownType int     `json:"skipped_unknown_type"`
+	Failed             int     `json:"failed"`
+	Bytes              int64   `json:"bytes"`
+	DurationSeconds    float64 `json:"duration_seconds"`
+}
+
+// String returns a one-line summary of the result, for logging
+func (r *ExportResult) String() string {
+	return fmt.Sprintf(
+		"scanned %d, exported %d, skipped %d of unknown type, failed %d, wrote %d bytes in %.2fs",
+		r.Scanned, r.Exported, r.SkippedUnknownType, r.Failed, r.Bytes, r.DurationSeconds,
+	)
+}
+
+// exportLines returns the lines written for one document in the given format
+func (e *Elasticer) exportLines(format, targetType string, doc *model.IndexedObject) ([]string, error) {
+	switch format {
+	case FormatNDJSON:
+		line, err := json.Marshal(&ExportedObject{TargetType: targetType, IndexedObject: doc})
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(line)}, nil
+	case FormatBulk:
+		indexedType := fmt.Sprintf("%s_metadata", targetType)
+		return elastic.NewBulkIndexRequest().Index(e.index).Type(indexedType).Parent(doc.ID).Id(doc.ID).Doc(doc).Source()
+	default:
+		return nil, fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+// Export writes the document that would be indexed for every object matched by filter to w, in the given format. It
+// only reads from the database, so the index doesn't need to be reachable. A non-nil error means the export stopped
+// early; objects that couldn't be formatted are only counted in the result.
+func (e *Elasticer) Export(context context.Context, d *database.Databaser, filter *database.ObjectFilter, format string, w io.Writer) (*ExportResult, error) {
+	ctx, span := otel.Tracer(otelName).Start(context, "Export")
+	defer span.End()
+
+	started := time.Now()
+	result := &ExportResult{}
+	finish := func(err error) (*ExportResult, error) {
+		result.DurationSeconds = time.Since(started).Seconds()
+		return result, err
+	}
+
+	if format != FormatNDJSON && format != FormatBulk {
+		return finish(fmt.Errorf("unknown export format: %s", format))
+	}
+
+	cursor, err := d.GetAllObjects(ctx, filter)
+	if err != nil {
+		return finish(fmt.Errorf("error reading objects: %w", err))
+	}
+	defer cursor.Close()
+
+	for {
+		obj, err := cursor.Next()
+		if err == database.EOS {
+			break
+		}
+		if err != nil {
+			return finish(fmt.Errorf("error reading objects: %w", err))
+		}
+		result.Scanned++
+
+		targetType := obj.TargetType
+		if !knownTypes[targetType] {
+			result.SkippedUnknownType++
+			continue
+		}
+
+		formatted, err := model.ObjectToIndexedObject(obj)
+		if err != nil {
+			logging.ForContext(ctx, log).WithField("entity", obj.ID).Errorf("Error formatting %s: %s", obj.ID, err)
+			result.Failed++
+			continue
+		}
+
+		lines, err := e.exportLines(format, targetType, formatted)
+		if err != nil {
+			logging.ForContext(ctx, log).WithField("entity", formatted.ID).Errorf("Error encoding %s: %s", formatted.ID, err)
+			result.Failed++
+			continue
+		}
+		for _, line := range lines {
+			n, err := io.WriteString(w, line+"\n")
+			result.Bytes += int64(n)
+			if err != nil {
+				return finish(fmt.Errorf("error writing export: %w", err))
+			}
+		}
+		result.Exported++
+	}
+
+	return finish(nil)
+}
@@ -0,0 +1,120 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/database"
+	"github.com/cyverse-de/templeton/model"
+)
+
+// indexBatch reads the objects for a batch of IDs with one set of queries and sends their index and delete requests
+// in one bulk request. Failures are recorded against the IDs they affect.
+func (e *Elasticer) indexBatch(ctx context.Context, d *database.Databaser, ids []string) *ReindexResult {
+	result := newReindexResult(ctx)
+
+	objects, err := d.GetObjects(ctx, ids)
+	if err != nil {
+		for _, id := range ids {
+			result.scanned()
+			result.AddItemFailure(id, fmt.Errorf("error reading %s: %w", id, err))
+		}
+		return result.finish()
+	}
+
+	// Deletes take a request per type, so this leaves room for every request to go out in the final flush
+	indexer := e.newIndexer(ctx, len(ids)*len(knownTypes)+1, "ids", result)
+
+	for _, id := range ids {
+		result.scanned()
+		obj := objects[id]
+
+		formatted, err := model.ObjectToIndexedObject(obj)
+		if err == model.ErrNoRecords {
+			for t := range knownTypes {
+				indexer.Add(elastic.NewBulkDeleteRequest().Index(e.index).Type(fmt.Sprintf("%s_metadata", t)).Routing(id).Id(id))
+			}
+			continue
+		}
+		if err != nil {
+			result.AddItemFailure(id, fmt.Errorf("error formatting %s: %w", id, err))
+			continue
+		}
+
+		if !knownTypes[obj.TargetType] {
+			result.skippedUnknownType()
+			continue
+		}
+
+		indexedType := fmt.Sprintf("%s_metadata", obj.TargetType)
+		req := elastic.NewBulkIndexRequest().Index(e.index).Type(indexedType).Parent(formatted.ID).Id(formatted.ID).Doc(formatted)
+		indexer.Add(req)
+	}
+
+	indexer.Flush()
+	return result.finish()
+}
+
+// IndexIDs reindexes the given entities, reading and sending them in batches of batchSize, with up to concurrency
+// batches in flight at once. The IDs should be in the canonical lowercase form. Failures are listed by ID in the
+// result's FailedItems, up to its limit, sorted by ID. Batches that haven't started when the context is cancelled are recorded as
+// failures.
+func (e *Elasticer) IndexIDs(context context.Context, d *database.Databaser, ids []string, batchSize, concurrency int) *ReindexResult {
+	ctx, span := otel.Tracer(otelName).Start(context, "IndexIDs")
+	defer span.End()
+
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	batches := make(chan []string)
+	go func() {
+		defer close(batches)
+		for start := 0; start < len(ids); start += batchSize {
+			end := min(start+batchSize, len(ids))
+			batches <- ids[start:end]
+		}
+	}()
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	result := newReindexResult(ctx)
+	progressFrom(ctx).setPhase("ids")
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				var batchResult *ReindexResult
+				if ctx.Err() != nil {
+					batchResult = newReindexResult(ctx)
+					for _, id := range batch {
+						batchResult.scanned()
+						batchResult.AddItemFailure(id, fmt.Errorf("stopped before reindexing %s: %w", id, ctx.Err()))
+					}
+				} else {
+					batchResult = e.indexBatch(ctx, d, batch)
+				}
+
+				mutex.Lock()
+				result.merge(batchResult)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(result.FailedItems, func(i, j int) bool { return result.FailedItems[i].ID < result.FailedItems[j].ID })
+	return result.finish()
+}
@@ -0,0 +1,251 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/throttle"
+)
+
+// maxImportLine is the longest line an import can contain
+const maxImportLine = 64 * 1024 * 1024
+
+// importItem is a type that contains one document read from an import
+type importItem struct {
+	id          string
+	indexedType string
+	doc         json.RawMessage
+}
+
+// invalidItemError is returned for a document that can't be imported, identified by its ID if it has one and
+// otherwise by its line number
+type invalidItemError struct {
+	item string
+	err  error
+}
+
+func (e *invalidItemError) Error() string {
+	return e.err.Error()
+}
+
+// importReader reads the documents of an import, in either of the formats written by Export
+type importReader struct {
+	scanner *bufio.Scanner
+	format  string
+	line    int
+}
+
+func newImportReader(r io.Reader, format string) *importReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	return &importReader{scanner: scanner, format: format}
+}
+
+// nextLine returns the next non-blank line, or io.EOF at the end of the input
+func (r *importReader) nextLine() ([]byte, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if line := r.scanner.Bytes(); len(bytes.TrimSpace(line)) > 0 {
+			return line, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// validate checks that an item has a valid ID and a known type
+func (r *importReader) validate(item *importItem, line int) error {
+	name := item.id
+	if name == "" {
+		name = fmt.Sprintf("line %d", line)
+	}
+	if _, err := uuid.Parse(item.id); err != nil {
+		return &invalidItemError{item: name, err: fmt.Errorf("invalid id on line %d: %w", line, err)}
+	}
+	targetType, ok := strings.CutSuffix(item.indexedType, "_metadata")
+	if !ok || !knownTypes[targetType] {
+		return &invalidItemError{item: name, err: fmt.Errorf("unknown type %q on line %d", item.indexedType, line)}
+	}
+	return nil
+}
+
+// nextNDJSON reads an ExportedObject
+func (r *importReader) nextNDJSON() (*importItem, error) {
+	line, err := r.nextLine()
+	if err != nil {
+		return nil, err
+	}
+
+	obj := ExportedObject{}
+	if err = json.Unmarshal(line, &obj); err != nil || obj.IndexedObject == nil {
+		if err == nil {
+			err = errors.New("no document")
+		}
+		return nil, &invalidItemError{item: fmt.Sprintf("line %d", r.line), err: fmt.Errorf("invalid document on line %d: %w", r.line, err)}
+	}
+
+	item := &importItem{id: obj.ID, indexedType: fmt.Sprintf("%s_metadata", obj.TargetType)}
+	if obj.TargetType == "" {
+		item.indexedType = ""
+	}
+	if err = r.validate(item, r.line); err != nil {
+		return nil, err
+	}
+	if item.doc, err = json.Marshal(obj.IndexedObject); err != nil {
+		return nil, &invalidItemError{item: item.id, err: err}
+	}
+	return item, nil
+}
+
+// bulkMeta is the metadata of an action line in a bulk request
+type bulkMeta struct {
+	Type string `json:"_type"`
+	ID   string `json:"_id"`
+}
+
+// nextBulk reads an index action and the document that follows it
+func (r *importReader) nextBulk() (*importItem, error) {
+	line, err := r.nextLine()
+	if err != nil {
+		return nil, err
+	}
+	actionLine := r.line
+
+	var action map[string]bulkMeta
+	if err = json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+		if err == nil {
+			err = errors.New("expected a single action")
+		}
+		return nil, &invalidItemError{item: fmt.Sprintf("line %d", actionLine), err: fmt.Errorf("invalid action on line %d: %w", actionLine, err)}
+	}
+
+	var (
+		op   string
+		meta bulkMeta
+	)
+	for k, v := range action {
+		op, meta = k, v
+	}
+	if op == "delete" {
+		return nil, &invalidItemError{item: meta.ID, err: fmt.Errorf("unsupported delete action on line %d", actionLine)}
+	}
+
+	// Every other action is followed by a document, which has to be consumed even if the action can't be imported.
+	doc, err := r.nextLine()
+	if err == io.EOF {
+		return nil, &invalidItemError{item: meta.ID, err: fmt.Errorf("no document follows the action on line %d", actionLine)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if op != "index" && op != "create" {
+		return nil, &invalidItemError{item: meta.ID, err: fmt.Errorf("unsupported %s action on line %d", op, actionLine)}
+	}
+	if !json.Valid(doc) {
+		return nil, &invalidItemError{item: meta.ID, err: fmt.Errorf("invalid document on line %d", r.line)}
+	}
+
+	item := &importItem{id: meta.ID, indexedType: meta.Type, doc: append(json.RawMessage{}, doc...)}
+	if err = r.validate(item, actionLine); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// next returns the next document, an *invalidItemError for a document that can't be imported, or io.EOF at the end of
+// the input. Any other error means the input can't be read any further.
+func (r *importReader) next() (*importItem, error) {
+	if r.format == FormatBulk {
+		return r.nextBulk()
+	}
+	return r.nextNDJSON()
+}
+
+// sendImportBatch sends one batch of documents in a single bulk request, recording the outcome of each of them
+func (e *Elasticer) sendImportBatch(ctx context.Context, index string, batch []*importItem, limiter *throttle.Limiter, result *ReindexResult) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := limiter.Wait(ctx, len(batch)); err != nil {
+		return err
+	}
+
+	// The bulk size leaves room for the whole batch to go out in the final flush
+	indexer := e.newIndexer(ctx, len(batch)+1, "import", result)
+	for _, item := range batch {
+		indexer.Add(elastic.NewBulkIndexRequest().Index(index).Type(item.indexedType).Parent(item.id).Id(item.id).Doc(item.doc))
+	}
+	indexer.Flush()
+	return nil
+}
+
+// Import reads documents in either of the formats written by Export and loads them into index, or the configured
+// index if it's empty. Documents are sent in bulk requests of batchSize, no faster than the limiter allows. Documents
+// that are invalid or can't be indexed are listed in the result's FailedItems, up to its limit; a non-nil error means
+// the input couldn't be read any further or the context was cancelled.
+func (e *Elasticer) Import(context context.Context, r io.Reader, format, index string, batchSize int, limiter *throttle.Limiter) (*ReindexResult, error) {
+	ctx, span := otel.Tracer(otelName).Start(context, "Import")
+	defer span.End()
+
+	if index == "" {
+		index = e.index
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	log := logging.ForContext(ctx, log)
+	result := newReindexResult(ctx)
+	progressFrom(ctx).setPhase("import")
+
+	reader := newImportReader(r, format)
+	var batch []*importItem
+	for {
+		item, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+
+		var invalid *invalidItemError
+		if errors.As(err, &invalid) {
+			result.scanned()
+			result.AddItemFailure(invalid.item, invalid.err)
+			continue
+		}
+		if err != nil {
+			result.addError(err)
+			return result.finish(), fmt.Errorf("error reading line %d: %w", reader.line+1, err)
+		}
+		result.scanned()
+
+		batch = append(batch, item)
+		if len(batch) < batchSize {
+			continue
+		}
+		if err = e.sendImportBatch(ctx, index, batch, limiter, result); err != nil {
+			result.addError(err)
+			return result.finish(), err
+		}
+		batch = nil
+		log.Infof("Imported %d of %d documents read so far.", result.Indexed, result.Scanned)
+	}
+
+	if err := e.sendImportBatch(ctx, index, batch, limiter, result); err != nil {
+		result.addError(err)
+		return result.finish(), err
+	}
+	return result.finish(), nil
+}
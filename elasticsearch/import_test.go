@@ -0,0 +1,222 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	importID      = "a0a64b1e-51a5-4a0e-b0d9-52a43ec2a4d6"
+	otherImportID = "0b1c1d0e-98b4-4d32-9d37-fd7d41a5a2b9"
+)
+
+// readImport reads every document from input, describing each one as "<type> <id>" or each invalid document as
+// "invalid <item>: <error>"
+func readImport(t *testing.T, input, format string) []string {
+	t.Helper()
+
+	var retval []string
+	r := newImportReader(strings.NewReader(input), format)
+	for {
+		item, err := r.next()
+		if err == io.EOF {
+			return retval
+		}
+
+		var invalid *invalidItemError
+		switch {
+		case errors.As(err, &invalid):
+			retval = append(retval, fmt.Sprintf("invalid %s: %s", invalid.item, invalid.err))
+		case err != nil:
+			t.Fatalf("next() returned an unexpected error: %s", err)
+		default:
+			retval = append(retval, fmt.Sprintf("%s %s", item.indexedType, item.id))
+		}
+	}
+}
+
+func TestImportReaderNDJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name: "documents and blank lines",
+			input: `{"target_type": "file", "id": "` + importID + `", "metadata": []}` + "\n\n  \n" +
+				`{"target_type": "folder", "id": "` + otherImportID + `"}` + "\n",
+			want: []string{"file_metadata " + importID, "folder_metadata " + otherImportID},
+		},
+		{
+			name:  "no document",
+			input: `{"target_type": "file"}`,
+			want:  []string{"invalid line 1: invalid document on line 1: no document"},
+		},
+		{
+			name:  "invalid JSON",
+			input: "{\n" + `{"target_type": "file", "id": "` + importID + `"}`,
+			want: []string{
+				"invalid line 1: invalid document on line 1: unexpected end of JSON input",
+				"file_metadata " + importID,
+			},
+		},
+		{
+			name:  "no target type",
+			input: `{"id": "` + importID + `"}`,
+			want:  []string{"invalid " + importID + `: unknown type "" on line 1`},
+		},
+		{
+			name:  "unknown target type",
+			input: `{"target_type": "user", "id": "` + importID + `"}`,
+			want:  []string{"invalid " + importID + `: unknown type "user_metadata" on line 1`},
+		},
+		{
+			name:  "bad UUID",
+			input: `{"target_type": "file", "id": "not-a-uuid"}`,
+			want:  []string{"invalid not-a-uuid: invalid id on line 1: invalid UUID length: 10"},
+		},
+		{
+			name:  "no ID",
+			input: `{"target_type": "file", "metadata": []}`,
+			want:  []string{"invalid line 1: invalid id on line 1: invalid UUID length: 0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readImport(t, tt.input, FormatNDJSON); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportReaderBulk(t *testing.T) {
+	action := func(op, docType, id string) string {
+		return fmt.Sprintf(`{"%s": {"_index": "data", "_type": "%s", "_id": "%s"}}`, op, docType, id) + "\n"
+	}
+	doc := `{"id": "` + importID + `"}` + "\n"
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "index and create",
+			input: action("index", "file_metadata", importID) + doc + "\n" + action("create", "folder_metadata", otherImportID) + doc,
+			want:  []string{"file_metadata " + importID, "folder_metadata " + otherImportID},
+		},
+		{
+			name:  "delete has no document",
+			input: action("delete", "file_metadata", importID) + action("index", "file_metadata", otherImportID) + doc,
+			want: []string{
+				"invalid " + importID + ": unsupported delete action on line 1",
+				"file_metadata " + otherImportID,
+			},
+		},
+		{
+			name:  "update document is skipped",
+			input: action("update", "file_metadata", importID) + doc + action("index", "file_metadata", otherImportID) + doc,
+			want: []string{
+				"invalid " + importID + ": unsupported update action on line 1",
+				"file_metadata " + otherImportID,
+			},
+		},
+		{
+			name:  "no document after the action",
+			input: action("index", "file_metadata", importID) + "\n",
+			want:  []string{"invalid " + importID + ": no document follows the action on line 1"},
+		},
+		{
+			name:  "unknown type",
+			input: action("index", "user_metadata", importID) + doc + action("index", "file", otherImportID) + doc,
+			want: []string{
+				"invalid " + importID + `: unknown type "user_metadata" on line 1`,
+				"invalid " + otherImportID + `: unknown type "file" on line 3`,
+			},
+		},
+		{
+			name:  "bad UUID",
+			input: action("index", "file_metadata", "not-a-uuid") + doc + action("index", "file_metadata", importID) + doc,
+			want: []string{
+				"invalid not-a-uuid: invalid id on line 1: invalid UUID length: 10",
+				"file_metadata " + importID,
+			},
+		},
+		{
+			name:  "invalid document",
+			input: action("index", "file_metadata", importID) + "{\n",
+			want:  []string{"invalid " + importID + ": invalid document on line 2"},
+		},
+		{
+			name:  "invalid action",
+			input: `{"index": {}, "create": {}}` + "\n",
+			want:  []string{"invalid line 1: invalid action on line 1: expected a single action"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readImport(t, tt.input, FormatBulk); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportReaderBulkDocument(t *testing.T) {
+	input := `{"index": {"_type": "file_metadata", "_id": "` + importID + `"}}` + "\n" + `{"id": "x"}` + "\n"
+	item, err := newImportReader(strings.NewReader(input), FormatBulk).next()
+	if err != nil {
+		t.Fatalf("next() returned an error: %s", err)
+	}
+	if string(item.doc) != `{"id": "x"}` {
+		t.Errorf("doc = %s, want the line after the action", item.doc)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	e := &Elasticer{index: "data"}
+	e.EnableDryRun()
+
+	// Each run's result only counts the requests that run would have sent
+	inputs := []string{
+		`{"target_type": "file", "id": "` + importID + `"}` + "\n" + `{"target_type": "folder", "id": "` + otherImportID + `"}`,
+		`{"target_type": "file", "id": "` + otherImportID + `"}`,
+	}
+	want := []map[string]int{
+		{"file_metadata": 1, "folder_metadata": 1},
+		{"file_metadata": 1},
+	}
+
+	for i, input := range inputs {
+		result, err := e.Import(context.Background(), strings.NewReader(input), FormatNDJSON, "", 10, nil)
+		if err != nil {
+			t.Fatalf("Import() returned an error: %s", err)
+		}
+		if result.DryRun == nil {
+			t.Fatalf("run %d has no dry run summary", i+1)
+		}
+
+		got := map[string]int{}
+		for docType, stats := range result.DryRun.Types {
+			got[docType] = stats.Indexed
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("run %d would have indexed %v, want %v", i+1, got, want[i])
+		}
+		if result.DryRun.Indexed != result.Indexed {
+			t.Errorf("run %d would have indexed %d in total, want %d", i+1, result.DryRun.Indexed, result.Indexed)
+		}
+	}
+}
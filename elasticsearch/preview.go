@@ -0,0 +1,216 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/database"
+	"github.com/cyverse-de/templeton/model"
+)
+
+const (
+	// DecisionIndex means the object's document would be indexed
+	DecisionIndex = "index"
+	// DecisionDelete means the object has no AVUs, comments or favorites, so its documents would be deleted
+	DecisionDelete = "delete"
+	// DecisionSkipUnknownType means the object's target type isn't indexed
+	DecisionSkipUnknownType = "skip_unknown_type"
+)
+
+const (
+	// DiffAdded marks a value that would be added to the index
+	DiffAdded = "added"
+	// DiffRemoved marks a value that would be removed from the index
+	DiffRemoved = "removed"
+	// DiffChanged marks a value that would be changed in the index
+	DiffChanged = "changed"
+)
+
+// StoredDocument is a type that contains a document currently in the index
+type StoredDocument struct {
+	Type   string      `json:"type"`
+	Source interface{} `json:"source"`
+}
+
+// DocumentDiff is a type that describes a single difference between the document that would be indexed and the one
+// in the index. The path starts with the document type, followed by the JSON field names and array indexes.
+type DocumentDiff struct {
+	Path     string      `json:"path"`
+	Op       string      `json:"op"`
+	Expected interface{} `json:"expected,omitempty"`
+	Current  interface{} `json:"current,omitempty"`
+}
+
+// Preview is a type that shows what reindexing one object would do, without doing it
+type Preview struct {
+	ID          string           `json:"id"`
+	TargetType  string           `json:"target_type,omitempty"`
+	Decision    string           `json:"decision"`
+	Index       string           `json:"index"`
+	IndexedType string           `json:"indexed_type,omitempty"`
+	Expected    interface{}      `json:"expected"`
+	Current     []StoredDocument `json:"current"`
+	Diff        []DocumentDiff   `json:"diff"`
+}
+
+// genericJSON round-trips v through JSON so that it can be compared with a document source
+func genericJSON(v interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var retval interface{}
+	err = json.Unmarshal(encoded, &retval)
+	return retval, err
+}
+
+// diffValues appends the differences between expected and current, found at path, to diffs
+func diffValues(path string, expected, current interface{}, diffs []DocumentDiff) []DocumentDiff {
+	switch {
+	case expected == nil && current == nil:
+		return diffs
+	case current == nil:
+		return append(diffs, DocumentDiff{Path: path, Op: DiffAdded, Expected: expected})
+	case expected == nil:
+		return append(diffs, DocumentDiff{Path: path, Op: DiffRemoved, Current: current})
+	}
+
+	expectedMap, expectedIsMap := expected.(map[string]interface{})
+	currentMap, currentIsMap := current.(map[string]interface{})
+	if expectedIsMap && currentIsMap {
+		keys := make(map[string]bool)
+		for k := range expectedMap {
+			keys[k] = true
+		}
+		for k := range currentMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			diffs = diffValues(childPath, expectedMap[k], currentMap[k], diffs)
+		}
+		return diffs
+	}
+
+	expectedSlice, expectedIsSlice := expected.([]interface{})
+	currentSlice, currentIsSlice := current.([]interface{})
+	if expectedIsSlice && currentIsSlice {
+		for i := 0; i < len(expectedSlice) || i < len(currentSlice); i++ {
+			var e, c interface{}
+			if i < len(expectedSlice) {
+				e = expectedSlice[i]
+			}
+			if i < len(currentSlice) {
+				c = currentSlice[i]
+			}
+			diffs = diffValues(fmt.Sprintf("%s[%d]", path, i), e, c, diffs)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(expected, current) {
+		diffs = append(diffs, DocumentDiff{Path: path, Op: DiffChanged, Expected: expected, Current: current})
+	}
+	return diffs
+}
+
+// storedDocuments fetches the documents for id from every known type
+func (e *Elasticer) storedDocuments(ctx context.Context, id string) ([]StoredDocument, error) {
+	var types []string
+	for t := range knownTypes {
+		types = append(types, fmt.Sprintf("%s_metadata", t))
+	}
+	sort.Strings(types)
+
+	mget := e.es.MultiGet()
+	for _, t := range types {
+		mget.Add(elastic.NewMultiGetItem().Index(e.index).Type(t).Routing(id).Id(id))
+	}
+	resp, err := mget.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := []StoredDocument{}
+	for _, doc := range resp.Docs {
+		if doc == nil || !doc.Found || doc.Source == nil {
+			continue
+		}
+		var source interface{}
+		if err = json.Unmarshal(*doc.Source, &source); err != nil {
+			return nil, err
+		}
+		retval = append(retval, StoredDocument{Type: doc.Type, Source: source})
+	}
+	return retval, nil
+}
+
+// Preview builds the document that would be indexed for one object and compares it with the documents in the index.
+// It doesn't write anything.
+func (e *Elasticer) Preview(context context.Context, d *database.Databaser, id string) (*Preview, error) {
+	ctx, span := otel.Tracer(otelName).Start(context, "Preview")
+	defer span.End()
+
+	retval := &Preview{ID: id, Index: e.index}
+
+	obj, err := d.GetObject(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", id, err)
+	}
+
+	formatted, err := model.ObjectToIndexedObject(obj)
+	switch {
+	case err == model.ErrNoRecords:
+		retval.Decision = DecisionDelete
+	case err != nil:
+		return nil, fmt.Errorf("error formatting %s: %w", id, err)
+	case !knownTypes[obj.TargetType]:
+		retval.TargetType = obj.TargetType
+		retval.Decision = DecisionSkipUnknownType
+	default:
+		retval.TargetType = obj.TargetType
+		retval.Decision = DecisionIndex
+		retval.IndexedType = fmt.Sprintf("%s_metadata", obj.TargetType)
+		if retval.Expected, err = genericJSON(formatted); err != nil {
+			return nil, err
+		}
+	}
+
+	if retval.Current, err = e.storedDocuments(ctx, id); err != nil {
+		return nil, fmt.Errorf("error fetching documents for %s: %w", id, err)
+	}
+
+	retval.Diff = []DocumentDiff{}
+	if retval.Decision == DecisionSkipUnknownType {
+		// Objects of unknown types are left alone, so nothing in the index would change
+		return retval, nil
+	}
+
+	// Compare the documents by type, so that a document stored under the wrong type shows up as one to remove
+	expected := map[string]interface{}{}
+	if retval.IndexedType != "" {
+		expected[retval.IndexedType] = retval.Expected
+	}
+	current := map[string]interface{}{}
+	for _, doc := range retval.Current {
+		current[doc.Type] = doc.Source
+	}
+	retval.Diff = diffValues("", expected, current, retval.Diff)
+
+	return retval, nil
+}
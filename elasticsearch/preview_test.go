@@ -0,0 +1,101 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	decode := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatalf("error decoding %s: %s", s, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		current  string
+		want     []DocumentDiff
+	}{
+		{
+			name: "both missing",
+		},
+		{
+			name:     "identical documents",
+			expected: `{"id": "a", "tags": ["x", "y"], "nested": {"n": 1}}`,
+			current:  `{"nested": {"n": 1}, "tags": ["x", "y"], "id": "a"}`,
+		},
+		{
+			name:     "whole document added",
+			expected: `{"id": "a"}`,
+			want:     []DocumentDiff{{Op: DiffAdded, Expected: decode(`{"id": "a"}`)}},
+		},
+		{
+			name:    "whole document removed",
+			current: `{"id": "a"}`,
+			want:    []DocumentDiff{{Op: DiffRemoved, Current: decode(`{"id": "a"}`)}},
+		},
+		{
+			name:     "fields in sorted order",
+			expected: `{"b": 2, "a": 1, "c": 3}`,
+			current:  `{"b": 20, "a": 10, "d": 4}`,
+			want: []DocumentDiff{
+				{Path: "a", Op: DiffChanged, Expected: 1.0, Current: 10.0},
+				{Path: "b", Op: DiffChanged, Expected: 2.0, Current: 20.0},
+				{Path: "c", Op: DiffAdded, Expected: 3.0},
+				{Path: "d", Op: DiffRemoved, Current: 4.0},
+			},
+		},
+		{
+			name:     "nested paths",
+			expected: `{"outer": {"inner": "x"}}`,
+			current:  `{"outer": {"inner": "y"}}`,
+			want:     []DocumentDiff{{Path: "outer.inner", Op: DiffChanged, Expected: "x", Current: "y"}},
+		},
+		{
+			name:     "array elements",
+			expected: `{"list": [1, 2, 3]}`,
+			current:  `{"list": [1, 5]}`,
+			want: []DocumentDiff{
+				{Path: "list[1]", Op: DiffChanged, Expected: 2.0, Current: 5.0},
+				{Path: "list[2]", Op: DiffAdded, Expected: 3.0},
+			},
+		},
+		{
+			name:     "fields inside array elements",
+			expected: `{"avus": [{"attr": "a", "value": "1"}]}`,
+			current:  `{"avus": [{"attr": "a", "value": "2"}, {"attr": "b"}]}`,
+			want: []DocumentDiff{
+				{Path: "avus[0].value", Op: DiffChanged, Expected: "1", Current: "2"},
+				{Path: "avus[1]", Op: DiffRemoved, Current: decode(`{"attr": "b"}`)},
+			},
+		},
+		{
+			name:     "type change",
+			expected: `{"v": [1]}`,
+			current:  `{"v": {"0": 1}}`,
+			want:     []DocumentDiff{{Path: "v", Op: DiffChanged, Expected: decode(`[1]`), Current: decode(`{"0": 1}`)}},
+		},
+		{
+			name:     "null and missing fields are the same",
+			expected: `{"a": null}`,
+			current:  `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffValues("", decode(tt.expected), decode(tt.current), nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffValues() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
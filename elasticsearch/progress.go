@@ -0,0 +1,69 @@
+package elasticsearch
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type progressKey struct{}
+
+// Progress is a type that counts the work done by a running reindex. Unlike a ReindexResult, which is only returned
+// once the work is done, it can be read while the reindex is still running.
+type Progress struct {
+	scanned            atomic.Int64
+	indexed            atomic.Int64
+	deleted            atomic.Int64
+	skippedUnknownType atomic.Int64
+	failed             atomic.Int64
+
+	mutex sync.Mutex
+	phase string
+}
+
+// ProgressSnapshot is a type that contains the counts of a Progress at one point in time
+type ProgressSnapshot struct {
+	Phase              string `json:"phase"`
+	Scanned            int64  `json:"scanned"`
+	Indexed            int64  `json:"indexed"`
+	Deleted            int64  `json:"deleted"`
+	SkippedUnknownType int64  `json:"skipped_unknown_type"`
+	Failed             int64  `json:"failed"`
+}
+
+// WithProgress returns a copy of ctx that makes the reindexing methods it's passed to count their work in p
+func WithProgress(ctx context.Context, p *Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// progressFrom returns the Progress carried by ctx, or nil if there isn't one
+func progressFrom(ctx context.Context) *Progress {
+	p, _ := ctx.Value(progressKey{}).(*Progress)
+	return p
+}
+
+// setPhase records which part of the work is running. It's safe to call on a nil Progress.
+func (p *Progress) setPhase(phase string) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.phase = phase
+}
+
+// Snapshot returns the current counts
+func (p *Progress) Snapshot() ProgressSnapshot {
+	p.mutex.Lock()
+	phase := p.phase
+	p.mutex.Unlock()
+
+	return ProgressSnapshot{
+		Phase:              phase,
+		Scanned:            p.scanned.Load(),
+		Indexed:            p.indexed.Load(),
+		Deleted:            p.deleted.Load(),
+		SkippedUnknownType: p.skippedUnknownType.Load(),
+		Failed:             p.failed.Load(),
+	}
+}
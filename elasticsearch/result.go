@@ -0,0 +1,176 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cyverse-de/templeton/logging"
+)
+
+// maxResultErrors caps the number of error messages kept in a ReindexResult; Failed still counts every failure
+const maxResultErrors = 100
+
+// maxFailedItems caps the number of failed entities listed in a ReindexResult; the rest are only counted
+const maxFailedItems = 1000
+
+// ItemFailure is a type that records why a single entity couldn't be reindexed
+type ItemFailure struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// ReindexResult is a type that summarizes the work done by a reindexing method
+type ReindexResult struct {
+	Scanned            int            `json:"scanned"`
+	Indexed            int            `json:"indexed"`
+	Deleted            int            `json:"deleted"`
+	SkippedUnknownType int            `json:"skipped_unknown_type"`
+	Failed             int            `json:"failed"`
+	Retried            int            `json:"retried"`
+	DurationSeconds    float64        `json:"duration_seconds"`
+	Errors             []string       `json:"errors"`
+	DryRun             *DryRunSummary `json:"dry_run,omitempty"`
+	// FailedItems lists the entities that failed, along with why, up to maxFailedItems. FailedItemsOmitted counts the
+	// ones left out.
+	FailedItems        []ItemFailure `json:"failed_items,omitempty"`
+	FailedItemsOmitted int           `json:"failed_items_omitted,omitempty"`
+
+	started  time.Time
+	logger   *logrus.Entry
+	progress *Progress
+	// dryRun counts the requests this work would have sent, if it was a dry run
+	dryRun *dryRunStats
+}
+
+// newReindexResult returns an empty result whose errors are logged with the fields carried by ctx, and which counts
+// its work in the Progress carried by ctx, if any
+func newReindexResult(ctx context.Context) *ReindexResult {
+	return &ReindexResult{
+		Errors:   []string{},
+		started:  time.Now(),
+		logger:   logging.ForContext(ctx, log),
+		progress: progressFrom(ctx),
+	}
+}
+
+func (r *ReindexResult) scanned() {
+	r.Scanned++
+	if r.progress != nil {
+		r.progress.scanned.Add(1)
+	}
+}
+
+func (r *ReindexResult) indexed() {
+	r.Indexed++
+	if r.progress != nil {
+		r.progress.indexed.Add(1)
+	}
+}
+
+func (r *ReindexResult) deleted() {
+	r.Deleted++
+	if r.progress != nil {
+		r.progress.deleted.Add(1)
+	}
+}
+
+func (r *ReindexResult) skippedUnknownType() {
+	r.SkippedUnknownType++
+	if r.progress != nil {
+		r.progress.skippedUnknownType.Add(1)
+	}
+}
+
+// retried records bulk requests that were sent again after the cluster rejected them
+func (r *ReindexResult) retried(n int) {
+	r.Retried += n
+}
+
+// addError records a failure, keeping its message if there's room
+func (r *ReindexResult) addError(err error) {
+	r.Failed++
+	if r.progress != nil {
+		r.progress.failed.Add(1)
+	}
+	if len(r.Errors) < maxResultErrors {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// AddItemFailure records a failure for a single entity, listing it in FailedItems if there's room. Failures past
+// that are only logged at debug level, so that a failure affecting every entity doesn't flood the log.
+func (r *ReindexResult) AddItemFailure(id string, err error) {
+	r.addError(err)
+	if len(r.FailedItems) >= maxFailedItems {
+		r.FailedItemsOmitted++
+		r.logger.WithField("entity", id).Debug(err)
+		return
+	}
+	r.logger.WithField("entity", id).Error(err)
+	r.FailedItems = append(r.FailedItems, ItemFailure{ID: id, Reason: err.Error()})
+}
+
+// addErrorf records a failure with a formatted message
+func (r *ReindexResult) addErrorf(format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+	r.logger.Error(err)
+	r.addError(err)
+}
+
+// merge adds the counts and errors of other into r
+func (r *ReindexResult) merge(other *ReindexResult) {
+	if other == nil {
+		return
+	}
+	r.Scanned += other.Scanned
+	r.Indexed += other.Indexed
+	r.Deleted += other.Deleted
+	r.SkippedUnknownType += other.SkippedUnknownType
+	r.Failed += other.Failed
+	r.Retried += other.Retried
+	r.FailedItemsOmitted += other.FailedItemsOmitted
+	if other.dryRun != nil {
+		if r.dryRun == nil {
+			r.dryRun = newDryRunStats()
+		}
+		r.dryRun.merge(other.dryRun)
+	}
+	for _, failure := range other.FailedItems {
+		if len(r.FailedItems) >= maxFailedItems {
+			r.FailedItemsOmitted++
+			continue
+		}
+		r.FailedItems = append(r.FailedItems, failure)
+	}
+	for _, msg := range other.Errors {
+		if len(r.Errors) >= maxResultErrors {
+			break
+		}
+		r.Errors = append(r.Errors, msg)
+	}
+}
+
+// finish records how long the work took, and what a dry run would have sent, and returns r
+func (r *ReindexResult) finish() *ReindexResult {
+	r.DurationSeconds = time.Since(r.started).Seconds()
+	if r.dryRun != nil {
+		r.DryRun = r.dryRun.summary()
+	}
+	return r
+}
+
+// OK returns whether the work completed without any failures
+func (r *ReindexResult) OK() bool {
+	return r.Failed == 0
+}
+
+// String returns a one-line summary of the result, for logging
+func (r *ReindexResult) String() string {
+	return fmt.Sprintf(
+		"scanned %d, indexed %d, deleted %d, skipped %d of unknown type, failed %d, retried %d in %.2fs",
+		r.Scanned, r.Indexed, r.Deleted, r.SkippedUnknownType, r.Failed, r.Retried, r.DurationSeconds,
+	)
+}
@@ -0,0 +1,222 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"go.opentelemetry.io/otel"
+	"gopkg.in/olivere/elastic.v5"
+
+	"github.com/cyverse-de/templeton/database"
+	"github.com/cyverse-de/templeton/logging"
+	"github.com/cyverse-de/templeton/model"
+)
+
+const (
+	// DriftMissing marks an object with metadata that has no document in the index
+	DriftMissing = "missing"
+	// DriftOrphaned marks a document in the index for an object that no longer has metadata
+	DriftOrphaned = "orphaned"
+	// DriftStale marks a document whose contents differ from what would be indexed now
+	DriftStale = "stale"
+)
+
+// verifyBatchSize is the number of documents fetched with each multi-get request while verifying
+const verifyBatchSize = 500
+
+// Drift is a type that describes a single difference between the database and the index, as written to a verify report
+type Drift struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Problem string `json:"problem"`
+}
+
+// VerifyResult is a type that summarizes the differences found by Verify
+type VerifyResult struct {
+	ObjectsScanned   int `json:"objects_scanned"`
+	DocumentsScanned int `json:"documents_scanned"`
+	Missing          int `json:"missing"`
+	Orphaned         int `json:"orphaned"`
+	Stale            int `json:"stale"`
+}
+
+// verifier is a type that accumulates the results of a verify run and writes the optional NDJSON report
+type verifier struct {
+	result  VerifyResult
+	encoder *json.Encoder
+}
+
+func (v *verifier) record(ctx context.Context, id, t, problem string) error {
+	switch problem {
+	case DriftMissing:
+		v.result.Missing++
+	case DriftOrphaned:
+		v.result.Orphaned++
+	case DriftStale:
+		v.result.Stale++
+	}
+	logging.ForContext(ctx, log).WithField("entity", id).Infof("Found %s document %s/%s", problem, t, id)
+
+	if v.encoder == nil {
+		return nil
+	}
+	return v.encoder.Encode(&Drift{ID: id, Type: t, Problem: problem})
+}
+
+// expectedDoc is a type that pairs an object's would-be document with the type it would be indexed as
+type expectedDoc struct {
+	indexedType string
+	doc         *model.IndexedObject
+}
+
+// sameDocument returns whether the stored document source matches the document that would be indexed now
+func sameDocument(source *json.RawMessage, doc *model.IndexedObject) (bool, error) {
+	if source == nil {
+		return false, nil
+	}
+
+	expectedJSON, err := json.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+
+	var expected, actual interface{}
+	if err = json.Unmarshal(expectedJSON, &expected); err != nil {
+		return false, err
+	}
+	if err = json.Unmarshal(*source, &actual); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(expected, actual), nil
+}
+
+// checkBatch fetches the stored documents for a batch of objects and records the ones that are missing or stale
+func (e *Elasticer) checkBatch(ctx context.Context, v *verifier, batch []expectedDoc) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	mget := e.es.MultiGet()
+	for _, ed := range batch {
+		mget.Add(elastic.NewMultiGetItem().Index(e.index).Type(ed.indexedType).Routing(ed.doc.ID).Id(ed.doc.ID))
+	}
+	resp, err := mget.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i, ed := range batch {
+		if i >= len(resp.Docs) || resp.Docs[i] == nil || !resp.Docs[i].Found {
+			if err = v.record(ctx, ed.doc.ID, ed.indexedType, DriftMissing); err != nil {
+				return err
+			}
+			continue
+		}
+
+		same, err := sameDocument(resp.Docs[i].Source, ed.doc)
+		if err != nil {
+			return err
+		}
+		if !same {
+			if err = v.record(ctx, ed.doc.ID, ed.indexedType, DriftStale); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyObjects walks every object in the database and checks its document in the index
+func (e *Elasticer) verifyObjects(ctx context.Context, d *database.Databaser, v *verifier) error {
+	cursor, err := d.GetAllObjects(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	var batch []expectedDoc
+	for {
+		obj, err := cursor.Next()
+		if err == database.EOS {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		v.result.ObjectsScanned++
+
+		if !knownTypes[obj.TargetType] {
+			continue
+		}
+
+		formatted, err := model.ObjectToIndexedObject(obj)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, expectedDoc{indexedType: fmt.Sprintf("%s_metadata", obj.TargetType), doc: formatted})
+
+		if len(batch) >= verifyBatchSize {
+			if err = e.checkBatch(ctx, v, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	return e.checkBatch(ctx, v, batch)
+}
+
+// verifyType walks every document of a type in the index and checks that its object still has AVUs
+func (e *Elasticer) verifyType(ctx context.Context, d *database.Databaser, v *verifier, t string) error {
+	scanner := e.es.Scroll(e.index).Type(t).Scroll("1m")
+
+	for {
+		docs, err := scanner.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range docs.Hits.Hits {
+			v.result.DocumentsScanned++
+
+			exists, err := d.HasRecords(ctx, hit.Id)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				if err = v.record(ctx, hit.Id, t, DriftOrphaned); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// Verify compares the database with the index without writing to either, and returns a summary of the differences.
+// If report is not nil, each difference is also written to it as a line of JSON.
+func (e *Elasticer) Verify(context context.Context, d *database.Databaser, report io.Writer) (*VerifyResult, error) {
+	ctx, span := otel.Tracer(otelName).Start(context, "Verify")
+	defer span.End()
+
+	v := &verifier{}
+	if report != nil {
+		v.encoder = json.NewEncoder(report)
+	}
+
+	if err := e.verifyObjects(ctx, d, v); err != nil {
+		return &v.result, err
+	}
+
+	for _, t := range []string{"file_metadata", "folder_metadata"} {
+		if err := e.verifyType(ctx, d, v, t); err != nil {
+			return &v.result, err
+		}
+	}
+
+	return &v.result, nil
+}
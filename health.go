@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cyverse-de/messaging/v9"
+)
+
+// errNotConsuming is returned by the AMQP readiness check when no consumer is running
+var errNotConsuming = errors.New("not consuming messages")
+
+// readinessTimeout bounds how long each readiness check may take
+const readinessTimeout = 5 * time.Second
+
+// readinessCheck returns an error if a dependency isn't ready
+type readinessCheck func(ctx context.Context) error
+
+// checkResult is the outcome of a single readiness check, as reported by /readyz
+type checkResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// healthResponse is the body returned by /healthz and /readyz
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, status int, body *healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error(err)
+	}
+}
+
+// handleHealthz reports that the process is alive
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, &healthResponse{Status: "ok"})
+}
+
+// readyzHandler runs every check and reports each result, returning a 503 if any of them failed
+func readyzHandler(checks map[string]readinessCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := &healthResponse{Status: "ok", Checks: make(map[string]checkResult)}
+		status := http.StatusOK
+
+		for name, check := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			err := check(ctx)
+			cancel()
+
+			if err != nil {
+				body.Checks[name] = checkResult{OK: false, Error: err.Error()}
+				body.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			body.Checks[name] = checkResult{OK: true}
+		}
+
+		writeHealth(w, status, body)
+	}
+}
+
+// registerHealthHandlers adds /healthz and /readyz to the debug listener
+func registerHealthHandlers(checks map[string]readinessCheck) {
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", readyzHandler(checks))
+}
+
+// amqpCheck returns a readiness check that passes while the mode's consumer is registered and its queue can be
+// inspected over the AMQP connection
+func amqpCheck(client *messaging.Client, queueName string, tracker *deliveryTracker) readinessCheck {
+	return func(ctx context.Context) error {
+		if !tracker.isConsuming() {
+			return errNotConsuming
+		}
+		exists, err := client.QueueExists(queueName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("queue %s does not exist", queueName)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx that carries fields, along with any it already carried, for ForContext to add to
+// log lines.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := logrus.Fields{}
+	if existing, ok := ctx.Value(fieldsKey{}).(logrus.Fields); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// ForContext returns entry with the fields carried by ctx and the trace and span IDs of its span, so that every line
+// logged while handling a message or running a reindex can be correlated with the others and with its trace.
+func ForContext(ctx context.Context, entry *logrus.Entry) *logrus.Entry {
+	if fields, ok := ctx.Value(fieldsKey{}).(logrus.Fields); ok {
+		entry = entry.WithFields(fields)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		entry = entry.WithFields(logrus.Fields{
+			"trace_id": sc.TraceID().String(),
+			"span_id":  sc.SpanID().String(),
+		})
+	}
+	return entry
+}
@@ -1,19 +1,45 @@
 package logging
 
 import (
+	"errors"
 	"log"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 var Log = logrus.WithFields(logrus.Fields{"service": "templeton"})
 
-func SetupLogging(configuredLevel string) {
-	var level logrus.Level
+// SetupLogging sets the level of the logger and whether it writes text or JSON lines
+func SetupLogging(configuredLevel, configuredFormat string) {
+	var formatter logrus.Formatter
+
+	switch configuredFormat {
+	case "text":
+		textFormatter := new(logrus.TextFormatter)
+		textFormatter.TimestampFormat = "2006-01-02 15:04:05.9999"
+		textFormatter.FullTimestamp = true
+		formatter = textFormatter
+	case "json":
+		jsonFormatter := new(logrus.JSONFormatter)
+		jsonFormatter.TimestampFormat = time.RFC3339Nano
+		formatter = jsonFormatter
+	default:
+		log.Fatal("incorrect log format")
+	}
 
-	formatter := new(logrus.TextFormatter)
-	formatter.TimestampFormat = "2006-01-02 15:04:05.9999"
-	formatter.FullTimestamp = true
+	if err := SetLevel(configuredLevel); err != nil {
+		log.Fatal(err)
+	}
+	Log.Logger.SetFormatter(formatter)
+}
+
+// ErrInvalidLevel is returned by SetLevel for names that aren't log levels
+var ErrInvalidLevel = errors.New("incorrect log level")
+
+// SetLevel changes the level of the logger. It can be called while the service is running.
+func SetLevel(configuredLevel string) error {
+	var level logrus.Level
 
 	switch configuredLevel {
 	case "trace":
@@ -31,9 +57,14 @@ func SetupLogging(configuredLevel string) {
 	case "panic":
 		level = logrus.PanicLevel
 	default:
-		log.Fatal("incorrect log level")
+		return ErrInvalidLevel
 	}
 
 	Log.Logger.SetLevel(level)
-	Log.Logger.SetFormatter(formatter)
+	return nil
+}
+
+// Level returns the name of the logger's current level
+func Level() string {
+	return Log.Logger.GetLevel().String()
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cyverse-de/templeton/elasticsearch"
+)
+
+func TestRetryReindex(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name     string
+		attempts int
+		failures int
+		calls    int
+		wantErr  error
+		// minWait is the least time the backoff should have waited in total, in multiples of reindexBackoff
+		minWait int
+	}{
+		{name: "succeeds first time", attempts: 3, failures: 0, calls: 1},
+		{name: "succeeds after failures", attempts: 3, failures: 2, calls: 3, minWait: 1 + 2},
+		{name: "gives up", attempts: 3, failures: 5, calls: 3, wantErr: errFailed, minWait: 1 + 2},
+		{name: "single attempt", attempts: 1, failures: 5, calls: 1, wantErr: errFailed},
+	}
+
+	defer func(attempts int, backoff time.Duration) {
+		reindexAttempts, reindexBackoff = attempts, backoff
+	}(reindexAttempts, reindexBackoff)
+	reindexBackoff = 5 * time.Millisecond
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reindexAttempts = tt.attempts
+
+			calls := 0
+			start := time.Now()
+			result, err := retryReindex(context.Background(), func() (*elasticsearch.ReindexResult, error) {
+				calls++
+				if calls <= tt.failures {
+					return &elasticsearch.ReindexResult{Scanned: calls}, errFailed
+				}
+				return &elasticsearch.ReindexResult{Scanned: calls}, nil
+			})
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retryReindex() returned %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("reindex was called %d times, want %d", calls, tt.calls)
+			}
+			if result == nil || result.Scanned != calls {
+				t.Errorf("retryReindex() returned %+v, want the last attempt's result", result)
+			}
+			if minWait := time.Duration(tt.minWait) * reindexBackoff; elapsed < minWait {
+				t.Errorf("retryReindex() took %s, want at least %s of backoff", elapsed, minWait)
+			}
+		})
+	}
+}
+
+func TestRetryReindexCancelled(t *testing.T) {
+	defer func(attempts int, backoff time.Duration) {
+		reindexAttempts, reindexBackoff = attempts, backoff
+	}(reindexAttempts, reindexBackoff)
+	reindexAttempts = 5
+	reindexBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := retryReindex(ctx, func() (*elasticsearch.ReindexResult, error) {
+		calls++
+		cancel()
+		return &elasticsearch.ReindexResult{}, errors.New("failed")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("retryReindex() returned %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("reindex was called %d times after the context was cancelled, want 1", calls)
+	}
+}
@@ -0,0 +1,165 @@
+// Package metrics contains the Prometheus metrics exported by templeton on /metrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "templeton"
+
+var (
+	// MessagesReceived counts AMQP deliveries received, by routing key
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "AMQP messages received, by routing key.",
+	}, []string{"routing_key"})
+
+	// MessagesAcked counts AMQP deliveries acknowledged, by routing key
+	MessagesAcked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_acked_total",
+		Help:      "AMQP messages acknowledged, by routing key.",
+	}, []string{"routing_key"})
+
+	// MessagesRejected counts AMQP deliveries rejected or negatively acknowledged, by routing key and whether they
+	// were requeued
+	MessagesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_rejected_total",
+		Help:      "AMQP messages rejected or nacked, by routing key and whether they were requeued.",
+	}, []string{"routing_key", "requeued"})
+
+	// HandlersInFlight tracks the number of AMQP message handlers currently running
+	HandlersInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "handlers_in_flight",
+		Help:      "AMQP message handlers currently running.",
+	})
+
+	// DocumentsIndexed counts documents written to Elasticsearch, by document type
+	DocumentsIndexed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_indexed_total",
+		Help:      "Documents written to Elasticsearch, by document type.",
+	}, []string{"type"})
+
+	// DocumentsDeleted counts documents deleted from Elasticsearch, by document type
+	DocumentsDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_deleted_total",
+		Help:      "Documents deleted from Elasticsearch, by document type.",
+	}, []string{"type"})
+
+	// BulkRequestDuration observes how long Elasticsearch bulk requests take
+	BulkRequestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bulk_request_duration_seconds",
+		Help:      "Latency of Elasticsearch bulk requests.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+
+	// BulkRequestFailures counts Elasticsearch bulk requests that returned an error
+	BulkRequestFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bulk_request_failures_total",
+		Help:      "Elasticsearch bulk requests that failed.",
+	})
+
+	// BulkItemRetries counts items in Elasticsearch bulk requests that were sent again after being rejected
+	BulkItemRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bulk_item_retries_total",
+		Help:      "Items in Elasticsearch bulk requests that were retried.",
+	})
+
+	// BulkItemFailures counts items in Elasticsearch bulk requests that failed permanently, by document type
+	BulkItemFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bulk_item_failures_total",
+		Help:      "Items in Elasticsearch bulk requests that failed and weren't retried, by document type.",
+	}, []string{"type"})
+
+	// BulkThrottleFraction is the fraction of the maximum bulk request rate currently allowed, which drops when
+	// Elasticsearch pushes back
+	BulkThrottleFraction = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bulk_throttle_fraction",
+		Help:      "Fraction of the maximum Elasticsearch bulk request rate currently allowed.",
+	})
+
+	// DBQueryDuration observes how long database queries take, by Databaser method
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of metadata database queries, by query.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"query"})
+
+	// DBReadsPaused is 1 while reads of every object are paused because the database is busy, and 0 otherwise
+	DBReadsPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_reads_paused",
+		Help:      "Whether reads of every object are paused because the metadata database is busy.",
+	})
+
+	// IndexingLag observes the time from the newest AVU modification of an object to its document being written, by
+	// the path that wrote it. The incremental path records every document it writes. The reindex path only records
+	// objects modified since the last successful full reindex in the same process started, since older objects were
+	// already indexed and their lag would only measure the age of the data. Other paths don't record it.
+	IndexingLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "indexing_lag_seconds",
+		Help:      "Time from the newest AVU modification of an object to its document being written to Elasticsearch.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 20),
+	}, []string{"path"})
+
+	// IndexingLagMax is the largest indexing lag among the documents most recently written by each path, covering the
+	// same documents as IndexingLag
+	IndexingLagMax = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "indexing_lag_max_seconds",
+		Help:      "Largest indexing lag among the documents in the most recent write, by path.",
+	}, []string{"path"})
+
+	// ReindexDuration observes how long full reindexes take
+	ReindexDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reindex_duration_seconds",
+		Help:      "Duration of full reindexes.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+	})
+
+	// ReindexLastSuccess is the Unix time of the last full reindex that completed without failures
+	ReindexLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reindex_last_success_timestamp_seconds",
+		Help:      "Unix time of the last full reindex that completed without failures.",
+	})
+)
+
+// ObserveQuery returns a function that records the time since ObserveQuery was called as the duration of query. It's
+// meant to be deferred at the top of a Databaser method.
+func ObserveQuery(query string) func() {
+	timer := prometheus.NewTimer(DBQueryDuration.WithLabelValues(query))
+	return func() { timer.ObserveDuration() }
+}
+
+// ObserveIndexingLag records the lags of the documents written together by path, and publishes the largest of them
+func ObserveIndexingLag(path string, lags ...time.Duration) {
+	if len(lags) == 0 {
+		return
+	}
+
+	var max time.Duration
+	for _, lag := range lags {
+		IndexingLag.WithLabelValues(path).Observe(lag.Seconds())
+		if lag > max {
+			max = lag
+		}
+	}
+	IndexingLagMax.WithLabelValues(path).Set(max.Seconds())
+}
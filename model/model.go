@@ -8,6 +8,9 @@ import (
 var (
 	// ErrNoAVUs is thrown when no AVUs are passed to the AVUsToIndexedObject function
 	ErrNoAVUs = fmt.Errorf("templeton/model: No AVUs provided to AVUsToIndexedObject")
+	// ErrNoRecords is thrown when an object passed to ObjectToIndexedObject has no AVUs, comments, or favorites, so
+	// there's nothing to index for it
+	ErrNoRecords = fmt.Errorf("templeton/model: No AVUs, comments, or favorites provided to ObjectToIndexedObject")
 )
 
 // AVURecord is a type that contains info from the avus table
@@ -22,41 +25,178 @@ type AVURecord struct {
 	ModifiedBy string
 	CreatedOn  time.Time
 	ModifiedOn time.Time
+	// TemplateID and TemplateName are empty unless the AVU was applied through a metadata template
+	TemplateID   string
+	TemplateName string
+}
+
+// CommentRecord is a type that contains info from the comments table
+type CommentRecord struct {
+	ID         string
+	Value      string
+	OwnerID    string
+	PostTime   time.Time
+	TargetId   string
+	TargetType string
+}
+
+// FavoriteRecord is a type that contains info from the favorites table
+type FavoriteRecord struct {
+	OwnerID    string
+	TargetId   string
+	TargetType string
+}
+
+// ObjectRecords is a type that contains all of the records for a single target
+type ObjectRecords struct {
+	// ID and TargetType identify the target. The type is taken from whichever records the target has, and is empty
+	// if it has none.
+	ID         string
+	TargetType string
+
+	AVUs      []AVURecord
+	Comments  []CommentRecord
+	Favorites []FavoriteRecord
+	// Templates holds the definitions of the templates applied to the AVUs, keyed by template ID
+	Templates map[string]*Template
+	// Ontologies is used to expand AVU values that refer to ontology classes, and may be nil
+	Ontologies *OntologyHierarchy
+}
+
+// SetTarget sets the object's ID, and its type from the first of its records
+func (o *ObjectRecords) SetTarget(id string) {
+	o.ID = id
+	switch {
+	case len(o.AVUs) > 0:
+		o.TargetType = o.AVUs[0].TargetType
+	case len(o.Comments) > 0:
+		o.TargetType = o.Comments[0].TargetType
+	case len(o.Favorites) > 0:
+		o.TargetType = o.Favorites[0].TargetType
+	default:
+		o.TargetType = ""
+	}
+}
+
+// LastModified returns the newest modification time of the object's AVUs and comments. Favorites aren't timestamped.
+func (o *ObjectRecords) LastModified() time.Time {
+	var retval time.Time
+	for _, avu := range o.AVUs {
+		if avu.ModifiedOn.After(retval) {
+			retval = avu.ModifiedOn
+		}
+	}
+	for _, c := range o.Comments {
+		if c.PostTime.After(retval) {
+			retval = c.PostTime
+		}
+	}
+	return retval
 }
 
 // IndexedAVU is a type that contains a single AVU as represented in ES
 type IndexedAVU struct {
-	Attribute string `json:"attribute"`
-	Value     string `json:"value"`
-	Unit      string `json:"unit"`
+	Attribute  string `json:"attribute"`
+	Value      string `json:"value"`
+	Unit       string `json:"unit"`
+	TemplateID string `json:"template_id,omitempty"`
+	// AncestorLabels holds the labels of the ancestors of the ontology class the value refers to, if any
+	AncestorLabels []string `json:"ancestor_labels,omitempty"`
+}
+
+// IndexedTemplate is a type that contains a metadata template applied to an object as represented in ES
+type IndexedTemplate struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// IndexedComment is a type that contains a single comment as represented in ES
+type IndexedComment struct {
+	ID       string    `json:"id"`
+	Value    string    `json:"value"`
+	Owner    string    `json:"owner"`
+	PostTime time.Time `json:"post_time"`
 }
 
 // IndexedObject is a type that contains info as it is sent to and received from ES
 type IndexedObject struct {
-	ID       string       `json:"id"`
-	Metadata []IndexedAVU `json:"metadata"`
+	ID        string            `json:"id"`
+	Metadata  []IndexedAVU      `json:"metadata"`
+	Templates []IndexedTemplate `json:"templates"`
+	Comments  []IndexedComment  `json:"comments"`
+	Favorites []string          `json:"favorites"`
+	// Completeness is the fraction of required template attributes present, or nil if no templates were applied
+	Completeness       *float64            `json:"completeness,omitempty"`
+	ValidationProblems []ValidationProblem `json:"validation_problems"`
 }
 
-// avuRecordToIndexedAVU turns a AVURecord into a *IndexedAVU
-func avuRecordToIndexedAVU(avu AVURecord) (*IndexedAVU, error) {
-	ia := &IndexedAVU{Attribute: avu.Attribute, Value: avu.Value, Unit: avu.Unit}
+// avuRecordToIndexedAVU turns a AVURecord into a *IndexedAVU, expanding ontology terms if ontologies is not nil
+func avuRecordToIndexedAVU(avu AVURecord, ontologies *OntologyHierarchy) (*IndexedAVU, error) {
+	ia := &IndexedAVU{Attribute: avu.Attribute, Value: avu.Value, Unit: avu.Unit, TemplateID: avu.TemplateID}
+	ia.AncestorLabels = ontologies.AncestorLabels(avu.Value, avu.Unit)
 	return ia, nil
 }
 
-// AVUsToIndexedObject takes []AVURecord and creates a *IndexedObject
-func AVUsToIndexedObject(avus []AVURecord) (*IndexedObject, error) {
+// AVUsToIndexedObject takes []AVURecord and creates a *IndexedObject. The ontologies argument may be nil.
+func AVUsToIndexedObject(avus []AVURecord, ontologies *OntologyHierarchy) (*IndexedObject, error) {
 	if len(avus) == 0 {
 		return nil, ErrNoAVUs
 	}
 	var ias []IndexedAVU
+	templates := []IndexedTemplate{}
+	seenTemplates := make(map[string]bool)
 	for _, avu := range avus {
-		ia, err := avuRecordToIndexedAVU(avu)
+		ia, err := avuRecordToIndexedAVU(avu, ontologies)
 		if err != nil {
 			return nil, err
 		}
 		ias = append(ias, *ia)
+
+		if avu.TemplateID != "" && !seenTemplates[avu.TemplateID] {
+			seenTemplates[avu.TemplateID] = true
+			templates = append(templates, IndexedTemplate{ID: avu.TemplateID, Name: avu.TemplateName})
+		}
+	}
+	retval := &IndexedObject{
+		ID:                 avus[0].TargetId,
+		Metadata:           ias,
+		Templates:          templates,
+		Comments:           []IndexedComment{},
+		Favorites:          []string{},
+		ValidationProblems: []ValidationProblem{},
+	}
+	return retval, nil
+}
+
+// ObjectToIndexedObject takes *ObjectRecords and creates a *IndexedObject, including comments, favorites, and the
+// results of validating the AVUs against their templates. Objects with only comments or favorites are indexed with
+// empty metadata. It returns ErrNoRecords if the object has no records at all.
+func ObjectToIndexedObject(obj *ObjectRecords) (*IndexedObject, error) {
+	if len(obj.AVUs) == 0 && len(obj.Comments) == 0 && len(obj.Favorites) == 0 {
+		return nil, ErrNoRecords
+	}
+
+	retval := &IndexedObject{
+		ID:                 obj.ID,
+		Metadata:           []IndexedAVU{},
+		Templates:          []IndexedTemplate{},
+		Comments:           []IndexedComment{},
+		Favorites:          []string{},
+		ValidationProblems: []ValidationProblem{},
+	}
+	if len(obj.AVUs) > 0 {
+		var err error
+		if retval, err = AVUsToIndexedObject(obj.AVUs, obj.Ontologies); err != nil {
+			return nil, err
+		}
+	}
+	retval.Completeness, retval.ValidationProblems = validateTemplates(obj.AVUs, obj.Templates)
+	for _, c := range obj.Comments {
+		retval.Comments = append(retval.Comments, IndexedComment{ID: c.ID, Value: c.Value, Owner: c.OwnerID, PostTime: c.PostTime})
+	}
+	for _, f := range obj.Favorites {
+		retval.Favorites = append(retval.Favorites, f.OwnerID)
 	}
-	retval := &IndexedObject{ID: avus[0].TargetId, Metadata: ias}
 	return retval, nil
 }
 
@@ -65,3 +205,8 @@ type UpdateMessage struct {
 	ID     string `json:"entity"`
 	Author string `json:"author"`
 }
+
+// TemplateReindexMessage is the format of template reindex messages. An empty TemplateID means every template.
+type TemplateReindexMessage struct {
+	TemplateID string `json:"template_id"`
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const objectID = "a0a64b1e-51a5-4a0e-b0d9-52a43ec2a4d6"
+
+func TestSetTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  ObjectRecords
+		want string
+	}{
+		{
+			name: "no records",
+			obj:  ObjectRecords{TargetType: "stale"},
+			want: "",
+		},
+		{
+			name: "AVUs come first",
+			obj: ObjectRecords{
+				AVUs:      []AVURecord{{TargetType: "file"}},
+				Comments:  []CommentRecord{{TargetType: "folder"}},
+				Favorites: []FavoriteRecord{{TargetType: "folder"}},
+			},
+			want: "file",
+		},
+		{
+			name: "comments before favorites",
+			obj: ObjectRecords{
+				Comments:  []CommentRecord{{TargetType: "folder"}},
+				Favorites: []FavoriteRecord{{TargetType: "file"}},
+			},
+			want: "folder",
+		},
+		{
+			name: "only favorites",
+			obj:  ObjectRecords{Favorites: []FavoriteRecord{{TargetType: "file"}}},
+			want: "file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.obj.SetTarget(objectID)
+			if tt.obj.ID != objectID {
+				t.Errorf("ID = %q, want %q", tt.obj.ID, objectID)
+			}
+			if tt.obj.TargetType != tt.want {
+				t.Errorf("TargetType = %q, want %q", tt.obj.TargetType, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectToIndexedObject(t *testing.T) {
+	posted := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	avu := AVURecord{Attribute: "color", Value: "blue", TargetId: objectID, TargetType: "file"}
+	comment := CommentRecord{ID: "c1", Value: "nice", OwnerID: "alice", PostTime: posted, TargetId: objectID, TargetType: "file"}
+	favorite := FavoriteRecord{OwnerID: "bob", TargetId: objectID, TargetType: "file"}
+
+	tests := []struct {
+		name    string
+		obj     ObjectRecords
+		want    *IndexedObject
+		wantErr error
+	}{
+		{
+			name:    "no records",
+			obj:     ObjectRecords{},
+			wantErr: ErrNoRecords,
+		},
+		{
+			name: "only comments",
+			obj:  ObjectRecords{Comments: []CommentRecord{comment}},
+			want: &IndexedObject{
+				ID:                 objectID,
+				Metadata:           []IndexedAVU{},
+				Templates:          []IndexedTemplate{},
+				Comments:           []IndexedComment{{ID: "c1", Value: "nice", Owner: "alice", PostTime: posted}},
+				Favorites:          []string{},
+				ValidationProblems: []ValidationProblem{},
+			},
+		},
+		{
+			name: "only favorites",
+			obj:  ObjectRecords{Favorites: []FavoriteRecord{favorite}},
+			want: &IndexedObject{
+				ID:                 objectID,
+				Metadata:           []IndexedAVU{},
+				Templates:          []IndexedTemplate{},
+				Comments:           []IndexedComment{},
+				Favorites:          []string{"bob"},
+				ValidationProblems: []ValidationProblem{},
+			},
+		},
+		{
+			name: "everything",
+			obj: ObjectRecords{
+				AVUs:      []AVURecord{avu},
+				Comments:  []CommentRecord{comment},
+				Favorites: []FavoriteRecord{favorite},
+			},
+			want: &IndexedObject{
+				ID:                 objectID,
+				Metadata:           []IndexedAVU{{Attribute: "color", Value: "blue"}},
+				Templates:          []IndexedTemplate{},
+				Comments:           []IndexedComment{{ID: "c1", Value: "nice", Owner: "alice", PostTime: posted}},
+				Favorites:          []string{"bob"},
+				ValidationProblems: []ValidationProblem{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.obj.SetTarget(objectID)
+			got, err := ObjectToIndexedObject(&tt.obj)
+			if err != tt.wantErr {
+				t.Fatalf("ObjectToIndexedObject() returned error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ObjectToIndexedObject() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		obj  ObjectRecords
+		want time.Time
+	}{
+		{
+			name: "newest AVU",
+			obj:  ObjectRecords{AVUs: []AVURecord{{ModifiedOn: newer}, {ModifiedOn: older}}},
+			want: newer,
+		},
+		{
+			name: "comment newer than the AVUs",
+			obj:  ObjectRecords{AVUs: []AVURecord{{ModifiedOn: older}}, Comments: []CommentRecord{{PostTime: newer}}},
+			want: newer,
+		},
+		{
+			name: "only favorites",
+			obj:  ObjectRecords{Favorites: []FavoriteRecord{{OwnerID: "bob"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.obj.LastModified(); !got.Equal(tt.want) {
+				t.Errorf("LastModified() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
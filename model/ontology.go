@@ -0,0 +1,109 @@
+package model
+
+import (
+	"sort"
+	"strings"
+)
+
+// OntologyHierarchy is a type that contains the classes of the ontologies loaded into the metadata DB and the
+// relationships between them, for looking up the ancestors of an AVU value
+type OntologyHierarchy struct {
+	labels  map[string]string   // class IRI -> label
+	parents map[string][]string // class IRI -> parent class IRIs
+	iris    map[string][]string // lowercased label -> class IRIs
+}
+
+// NewOntologyHierarchy returns a pointer to an empty OntologyHierarchy
+func NewOntologyHierarchy() *OntologyHierarchy {
+	return &OntologyHierarchy{
+		labels:  make(map[string]string),
+		parents: make(map[string][]string),
+		iris:    make(map[string][]string),
+	}
+}
+
+// AddClass adds a class to the hierarchy
+func (h *OntologyHierarchy) AddClass(iri, label string) {
+	if _, ok := h.labels[iri]; ok {
+		return
+	}
+	h.labels[iri] = label
+	if label != "" {
+		key := strings.ToLower(label)
+		h.iris[key] = append(h.iris[key], iri)
+	}
+}
+
+// AddParent records that parentIRI is a direct parent of classIRI
+func (h *OntologyHierarchy) AddParent(classIRI, parentIRI string) {
+	for _, p := range h.parents[classIRI] {
+		if p == parentIRI {
+			return
+		}
+	}
+	h.parents[classIRI] = append(h.parents[classIRI], parentIRI)
+}
+
+// Len returns the number of classes in the hierarchy
+func (h *OntologyHierarchy) Len() int {
+	return len(h.labels)
+}
+
+// classesFor returns the IRIs of the classes that the given terms refer to, either by IRI or by label
+func (h *OntologyHierarchy) classesFor(terms ...string) []string {
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+		if _, ok := h.labels[term]; ok {
+			return []string{term}
+		}
+	}
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+		if iris, ok := h.iris[strings.ToLower(term)]; ok {
+			return iris
+		}
+	}
+	return nil
+}
+
+// AncestorLabels returns the labels of every ancestor of the classes referred to by the given terms, which may be
+// class IRIs or labels, sorted so that documents don't change with the order the hierarchy was loaded in. The result is
+// nil if none of the terms refer to a known class.
+func (h *OntologyHierarchy) AncestorLabels(terms ...string) []string {
+	if h == nil {
+		return nil
+	}
+
+	var retval []string
+	seenIRIs := make(map[string]bool)
+	seenLabels := make(map[string]bool)
+
+	queue := h.classesFor(terms...)
+	for _, iri := range queue {
+		seenIRIs[iri] = true
+	}
+	for len(queue) > 0 {
+		iri := queue[0]
+		queue = queue[1:]
+
+		for _, parent := range h.parents[iri] {
+			if seenIRIs[parent] {
+				continue
+			}
+			seenIRIs[parent] = true
+			queue = append(queue, parent)
+
+			label := h.labels[parent]
+			if label != "" && !seenLabels[label] {
+				seenLabels[label] = true
+				retval = append(retval, label)
+			}
+		}
+	}
+	sort.Strings(retval)
+	return retval
+}
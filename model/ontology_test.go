@@ -0,0 +1,109 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAncestorLabels(t *testing.T) {
+	type edge struct{ class, parent string }
+
+	tests := []struct {
+		name    string
+		classes map[string]string
+		edges   []edge
+		terms   []string
+		want    []string
+	}{
+		{
+			name:    "unknown term",
+			classes: map[string]string{"iri:a": "A"},
+			terms:   []string{"iri:z", "Z"},
+			want:    nil,
+		},
+		{
+			name:    "no ancestors",
+			classes: map[string]string{"iri:a": "A"},
+			terms:   []string{"iri:a"},
+			want:    nil,
+		},
+		{
+			name:    "chain",
+			classes: map[string]string{"iri:a": "A", "iri:b": "B", "iri:c": "C"},
+			edges:   []edge{{"iri:a", "iri:b"}, {"iri:b", "iri:c"}},
+			terms:   []string{"iri:a"},
+			want:    []string{"B", "C"},
+		},
+		{
+			name:    "lookup by label ignores case",
+			classes: map[string]string{"iri:a": "Leaf", "iri:b": "Root"},
+			edges:   []edge{{"iri:a", "iri:b"}},
+			terms:   []string{"", "leaf"},
+			want:    []string{"Root"},
+		},
+		{
+			name:    "IRI takes precedence over label",
+			classes: map[string]string{"iri:a": "iri:b", "iri:b": "B", "iri:p": "P", "iri:q": "Q"},
+			edges:   []edge{{"iri:a", "iri:p"}, {"iri:b", "iri:q"}},
+			terms:   []string{"iri:b"},
+			want:    []string{"Q"},
+		},
+		{
+			name:    "diamond",
+			classes: map[string]string{"iri:a": "A", "iri:l": "Left", "iri:r": "Right", "iri:top": "Top"},
+			edges:   []edge{{"iri:a", "iri:r"}, {"iri:a", "iri:l"}, {"iri:l", "iri:top"}, {"iri:r", "iri:top"}},
+			terms:   []string{"iri:a"},
+			want:    []string{"Left", "Right", "Top"},
+		},
+		{
+			name:    "cycle leaves out the class itself",
+			classes: map[string]string{"iri:a": "A", "iri:b": "B", "iri:c": "C"},
+			edges:   []edge{{"iri:a", "iri:b"}, {"iri:b", "iri:c"}, {"iri:c", "iri:a"}},
+			terms:   []string{"iri:a"},
+			want:    []string{"B", "C"},
+		},
+		{
+			name:    "self parent",
+			classes: map[string]string{"iri:a": "A", "iri:b": "B"},
+			edges:   []edge{{"iri:a", "iri:a"}, {"iri:a", "iri:b"}},
+			terms:   []string{"iri:a"},
+			want:    []string{"B"},
+		},
+		{
+			name:    "shared labels are listed once",
+			classes: map[string]string{"iri:a": "A", "iri:b1": "B", "iri:b2": "B", "iri:c": ""},
+			edges:   []edge{{"iri:a", "iri:b1"}, {"iri:a", "iri:b2"}, {"iri:a", "iri:c"}},
+			terms:   []string{"iri:a"},
+			want:    []string{"B"},
+		},
+		{
+			name:    "label shared by several classes",
+			classes: map[string]string{"iri:x1": "X", "iri:x2": "X", "iri:p": "P", "iri:q": "Q"},
+			edges:   []edge{{"iri:x1", "iri:q"}, {"iri:x2", "iri:p"}},
+			terms:   []string{"X"},
+			want:    []string{"P", "Q"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewOntologyHierarchy()
+			for iri, label := range tt.classes {
+				h.AddClass(iri, label)
+			}
+			for _, e := range tt.edges {
+				h.AddParent(e.class, e.parent)
+			}
+			if got := h.AncestorLabels(tt.terms...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AncestorLabels(%q) = %q, want %q", tt.terms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAncestorLabelsNilHierarchy(t *testing.T) {
+	var h *OntologyHierarchy
+	if got := h.AncestorLabels("iri:a"); got != nil {
+		t.Errorf("AncestorLabels on a nil hierarchy = %q, want nil", got)
+	}
+}
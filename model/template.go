@@ -0,0 +1,150 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TemplateAttribute is a type that contains the definition of a single attribute in a metadata template
+type TemplateAttribute struct {
+	ID         string
+	Name       string
+	Required   bool
+	ValueType  string
+	EnumValues []string
+}
+
+// Template is a type that contains a metadata template and its attribute definitions
+type Template struct {
+	ID         string
+	Name       string
+	Attributes []TemplateAttribute
+}
+
+// ValidationProblem is a type that describes an AVU that is missing or doesn't match its template, as represented in ES
+type ValidationProblem struct {
+	TemplateID string `json:"template_id"`
+	Attribute  string `json:"attribute"`
+	Value      string `json:"value,omitempty"`
+	Problem    string `json:"problem"`
+}
+
+// timestampFormats are the formats accepted for values of attributes with the Timestamp value type
+var timestampFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// checkValue returns a description of why value is not valid for attr, or an empty string if it is
+func checkValue(attr TemplateAttribute, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	switch attr.ValueType {
+	case "Boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "value is not a boolean"
+		}
+	case "Integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "value is not an integer"
+		}
+	case "Number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "value is not a number"
+		}
+	case "Timestamp":
+		if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return ""
+		}
+		for _, f := range timestampFormats {
+			if _, err := time.Parse(f, value); err == nil {
+				return ""
+			}
+		}
+		return "value is not a timestamp"
+	case "URL/URI":
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" {
+			return "value is not a URL"
+		}
+	case "Enum":
+		for _, ev := range attr.EnumValues {
+			if ev == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("value is not one of: %s", strings.Join(attr.EnumValues, ", "))
+	}
+	return ""
+}
+
+// validateTemplates checks the AVUs applied through each template against that template's attribute definitions. It
+// returns the fraction of required attributes that are present across all of the templates, and any problems found.
+// The returned completeness is nil if none of the AVUs were applied through a known template.
+func validateTemplates(avus []AVURecord, templates map[string]*Template) (*float64, []ValidationProblem) {
+	problems := []ValidationProblem{}
+
+	// templateOrder keeps the problems in a stable order from one indexing run to the next
+	var templateOrder []string
+	applied := make(map[string][]AVURecord)
+	for _, avu := range avus {
+		if avu.TemplateID == "" {
+			continue
+		}
+		if _, ok := applied[avu.TemplateID]; !ok {
+			templateOrder = append(templateOrder, avu.TemplateID)
+		}
+		applied[avu.TemplateID] = append(applied[avu.TemplateID], avu)
+	}
+
+	var required, present int
+	anyTemplates := false
+	for _, templateID := range templateOrder {
+		templateAVUs := applied[templateID]
+		tmpl, ok := templates[templateID]
+		if !ok {
+			continue
+		}
+		anyTemplates = true
+
+		for _, attr := range tmpl.Attributes {
+			found := false
+			for _, avu := range templateAVUs {
+				if avu.Attribute != attr.Name {
+					continue
+				}
+				if avu.Value != "" || attr.ValueType == "Grouping" {
+					found = true
+				}
+				if problem := checkValue(attr, avu.Value); problem != "" {
+					problems = append(problems, ValidationProblem{TemplateID: templateID, Attribute: attr.Name, Value: avu.Value, Problem: problem})
+				}
+			}
+
+			if attr.Required {
+				required++
+				if found {
+					present++
+				} else {
+					problems = append(problems, ValidationProblem{TemplateID: templateID, Attribute: attr.Name, Problem: "required attribute is missing"})
+				}
+			}
+		}
+	}
+
+	if !anyTemplates {
+		return nil, problems
+	}
+
+	completeness := 1.0
+	if required > 0 {
+		completeness = float64(present) / float64(required)
+	}
+	return &completeness, problems
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueType string
+		enum      []string
+		value     string
+		want      string
+	}{
+		{"empty value is always valid", "Integer", nil, "", ""},
+		{"boolean", "Boolean", nil, "true", ""},
+		{"bad boolean", "Boolean", nil, "yes", "value is not a boolean"},
+		{"integer", "Integer", nil, "-42", ""},
+		{"bad integer", "Integer", nil, "4.2", "value is not an integer"},
+		{"number", "Number", nil, "4.2e3", ""},
+		{"bad number", "Number", nil, "four", "value is not a number"},
+		{"epoch timestamp", "Timestamp", nil, "1700000000000", ""},
+		{"RFC 3339 timestamp", "Timestamp", nil, "2023-11-14T22:13:20Z", ""},
+		{"timestamp without a zone", "Timestamp", nil, "2023-11-14T22:13:20", ""},
+		{"timestamp with a space", "Timestamp", nil, "2023-11-14 22:13:20", ""},
+		{"date", "Timestamp", nil, "2023-11-14", ""},
+		{"bad timestamp", "Timestamp", nil, "14/11/2023", "value is not a timestamp"},
+		{"URL", "URL/URI", nil, "https://example.org/path", ""},
+		{"URL without a scheme", "URL/URI", nil, "example.org/path", "value is not a URL"},
+		{"enum", "Enum", []string{"a", "b"}, "b", ""},
+		{"bad enum", "Enum", []string{"a", "b"}, "c", "value is not one of: a, b"},
+		{"unchecked type", "String", nil, "anything", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attr := TemplateAttribute{Name: "attr", ValueType: tt.valueType, EnumValues: tt.enum}
+			if got := checkValue(attr, tt.value); got != tt.want {
+				t.Errorf("checkValue(%s, %q) = %q, want %q", tt.valueType, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	templates := map[string]*Template{
+		"t1": {
+			ID:   "t1",
+			Name: "First",
+			Attributes: []TemplateAttribute{
+				{Name: "title", Required: true, ValueType: "String"},
+				{Name: "count", ValueType: "Integer"},
+				{Name: "group", Required: true, ValueType: "Grouping"},
+			},
+		},
+		"t2": {
+			ID:   "t2",
+			Name: "Second",
+			Attributes: []TemplateAttribute{
+				{Name: "kind", Required: true, ValueType: "Enum", EnumValues: []string{"x", "y"}},
+			},
+		},
+	}
+	avu := func(templateID, attribute, value string) AVURecord {
+		return AVURecord{Attribute: attribute, Value: value, TemplateID: templateID}
+	}
+
+	tests := []struct {
+		name         string
+		avus         []AVURecord
+		completeness *float64
+		problems     []ValidationProblem
+	}{
+		{
+			name:     "no AVUs",
+			problems: []ValidationProblem{},
+		},
+		{
+			name:     "AVUs outside of templates",
+			avus:     []AVURecord{avu("", "title", "a")},
+			problems: []ValidationProblem{},
+		},
+		{
+			name:     "unknown template",
+			avus:     []AVURecord{avu("t9", "title", "a")},
+			problems: []ValidationProblem{},
+		},
+		{
+			name:         "complete and valid",
+			avus:         []AVURecord{avu("t1", "title", "a"), avu("t1", "count", "3"), avu("t1", "group", "")},
+			completeness: ptr(1.0),
+			problems:     []ValidationProblem{},
+		},
+		{
+			name:         "empty required value",
+			avus:         []AVURecord{avu("t1", "title", ""), avu("t1", "group", "")},
+			completeness: ptr(0.5),
+			problems: []ValidationProblem{
+				{TemplateID: "t1", Attribute: "title", Problem: "required attribute is missing"},
+			},
+		},
+		{
+			name:         "invalid value",
+			avus:         []AVURecord{avu("t1", "title", "a"), avu("t1", "count", "many"), avu("t1", "group", "")},
+			completeness: ptr(1.0),
+			problems: []ValidationProblem{
+				{TemplateID: "t1", Attribute: "count", Value: "many", Problem: "value is not an integer"},
+			},
+		},
+		{
+			name:         "problems follow the order templates were first applied",
+			avus:         []AVURecord{avu("t2", "kind", "z"), avu("t1", "count", "1")},
+			completeness: ptr(1.0 / 3),
+			problems: []ValidationProblem{
+				{TemplateID: "t2", Attribute: "kind", Value: "z", Problem: "value is not one of: x, y"},
+				{TemplateID: "t1", Attribute: "title", Problem: "required attribute is missing"},
+				{TemplateID: "t1", Attribute: "group", Problem: "required attribute is missing"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completeness, problems := validateTemplates(tt.avus, templates)
+			switch {
+			case tt.completeness == nil && completeness != nil:
+				t.Errorf("completeness = %v, want nil", *completeness)
+			case tt.completeness != nil && completeness == nil:
+				t.Errorf("completeness = nil, want %v", *tt.completeness)
+			case tt.completeness != nil && *completeness != *tt.completeness:
+				t.Errorf("completeness = %v, want %v", *completeness, *tt.completeness)
+			}
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("problems = %+v, want %+v", problems, tt.problems)
+			}
+		})
+	}
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
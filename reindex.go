@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cyverse-de/templeton/database"
+	"github.com/cyverse-de/templeton/elasticsearch"
+)
+
+// errReindexRunning is returned when a reindex is requested while another one is running
+var errReindexRunning = errors.New("a reindex is already running")
+
+// Where a reindex was started from
+const (
+	reindexSourceAdmin = "admin"
+	reindexSourceAMQP  = "amqp"
+)
+
+// reindexJob is a type that describes a reindex started through the admin API or by a periodic reindex message
+type reindexJob struct {
+	Source     string                         `json:"source"`
+	TemplateID string                         `json:"template_id,omitempty"`
+	Filter     *database.ObjectFilter         `json:"filter,omitempty"`
+	Started    time.Time                      `json:"started"`
+	Finished   *time.Time                     `json:"finished,omitempty"`
+	Running    bool                           `json:"running"`
+	Attempt    int                            `json:"attempt"`
+	Progress   elasticsearch.ProgressSnapshot `json:"progress"`
+	Result     *elasticsearch.ReindexResult   `json:"result,omitempty"`
+	Error      string                         `json:"error,omitempty"`
+
+	progress *elasticsearch.Progress
+	// done is closed once the job finishes
+	done chan struct{}
+}
+
+// reindexTracker is a type that keeps track of the current or last reindex, so that only one runs at a time no matter
+// where it was started from, and so that its progress can be reported
+type reindexTracker struct {
+	mutex sync.Mutex
+	job   *reindexJob
+}
+
+func newReindexTracker() *reindexTracker {
+	return &reindexTracker{}
+}
+
+// start registers a new reindex, or returns errReindexRunning if another one hasn't finished yet
+func (t *reindexTracker) start(source, templateID string, filter *database.ObjectFilter) (*reindexJob, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.job != nil && t.job.Running {
+		return nil, errReindexRunning
+	}
+	t.job = &reindexJob{
+		Source:     source,
+		TemplateID: templateID,
+		Filter:     filter,
+		Started:    time.Now(),
+		Running:    true,
+		progress:   &elasticsearch.Progress{},
+		done:       make(chan struct{}),
+	}
+	return t.job, nil
+}
+
+// startWhenIdle registers a new reindex once the running one, if any, has finished. It returns the context's error if
+// the context is cancelled first.
+func (t *reindexTracker) startWhenIdle(ctx context.Context, source, templateID string, filter *database.ObjectFilter) (*reindexJob, error) {
+	for {
+		job, err := t.start(source, templateID, filter)
+		if err == nil {
+			return job, nil
+		}
+
+		t.mutex.Lock()
+		done := t.job.done
+		t.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done:
+		}
+	}
+}
+
+// attempt returns a copy of ctx that counts the progress of a new attempt at job, starting from zero
+func (t *reindexTracker) attempt(ctx context.Context, job *reindexJob) context.Context {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	job.Attempt++
+	if job.Attempt > 1 {
+		job.progress = &elasticsearch.Progress{}
+	}
+	return elasticsearch.WithProgress(ctx, job.progress)
+}
+
+// finish records the outcome of job
+func (t *reindexTracker) finish(job *reindexJob, result *elasticsearch.ReindexResult, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	finished := time.Now()
+	job.Finished = &finished
+	job.Running = false
+	job.Result = result
+	if err != nil {
+		job.Error = err.Error()
+	}
+	close(job.done)
+}
+
+// describe returns a copy of job with its current progress
+func (t *reindexTracker) describe(job *reindexJob) *reindexJob {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	copied := *job
+	copied.Progress = job.progress.Snapshot()
+	return &copied
+}
+
+// status returns a copy of the current or last reindex, or nil if none has been started
+func (t *reindexTracker) status() *reindexJob {
+	t.mutex.Lock()
+	job := t.job
+	t.mutex.Unlock()
+
+	if job == nil {
+		return nil
+	}
+	return t.describe(job)
+}
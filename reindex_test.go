@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cyverse-de/templeton/elasticsearch"
+)
+
+func TestReindexTrackerStart(t *testing.T) {
+	reindexes := newReindexTracker()
+	if job := reindexes.status(); job != nil {
+		t.Fatalf("status() before any reindex = %+v, want nil", job)
+	}
+
+	job, err := reindexes.start(reindexSourceAMQP, "", nil)
+	if err != nil {
+		t.Fatalf("start() returned an error: %s", err)
+	}
+	if _, err = reindexes.start(reindexSourceAdmin, "", nil); !errors.Is(err, errReindexRunning) {
+		t.Fatalf("start() while another reindex is running returned %v, want %v", err, errReindexRunning)
+	}
+	if status := reindexes.status(); status.Source != reindexSourceAMQP || !status.Running {
+		t.Errorf("status() = %+v, want the running AMQP reindex", status)
+	}
+
+	reindexes.finish(job, &elasticsearch.ReindexResult{}, errors.New("failed"))
+	status := reindexes.status()
+	if status.Running || status.Finished == nil || status.Error != "failed" {
+		t.Errorf("status() after finishing = %+v, want a finished reindex with its error", status)
+	}
+
+	if _, err = reindexes.start(reindexSourceAdmin, "", nil); err != nil {
+		t.Errorf("start() after the last reindex finished returned an error: %s", err)
+	}
+}
+
+func TestReindexTrackerStartWhenIdle(t *testing.T) {
+	reindexes := newReindexTracker()
+	running, err := reindexes.start(reindexSourceAdmin, "", nil)
+	if err != nil {
+		t.Fatalf("start() returned an error: %s", err)
+	}
+
+	started := make(chan *reindexJob)
+	go func() {
+		job, err := reindexes.startWhenIdle(context.Background(), reindexSourceAMQP, "", nil)
+		if err != nil {
+			t.Errorf("startWhenIdle() returned an error: %s", err)
+		}
+		started <- job
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("startWhenIdle() returned while another reindex was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	reindexes.finish(running, nil, nil)
+	select {
+	case job := <-started:
+		if job == nil || job.Source != reindexSourceAMQP {
+			t.Errorf("startWhenIdle() = %+v, want the AMQP reindex", job)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("startWhenIdle() didn't return after the running reindex finished")
+	}
+}
+
+func TestReindexTrackerStartWhenIdleCancelled(t *testing.T) {
+	reindexes := newReindexTracker()
+	if _, err := reindexes.start(reindexSourceAdmin, "", nil); err != nil {
+		t.Fatalf("start() returned an error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := reindexes.startWhenIdle(ctx, reindexSourceAMQP, "", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("startWhenIdle() with a cancelled context returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestReindexTrackerAttempt(t *testing.T) {
+	reindexes := newReindexTracker()
+	job, err := reindexes.start(reindexSourceAMQP, "", nil)
+	if err != nil {
+		t.Fatalf("start() returned an error: %s", err)
+	}
+
+	reindexes.attempt(context.Background(), job)
+	first := job.progress
+	reindexes.attempt(context.Background(), job)
+	if job.progress == first {
+		t.Error("a retry counted its progress on top of the last attempt's")
+	}
+	if status := reindexes.status(); status.Attempt != 2 {
+		t.Errorf("Attempt = %d, want 2", status.Attempt)
+	}
+}
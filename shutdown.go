@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cyverse-de/messaging/v9"
+	"github.com/cyverse-de/templeton/metrics"
+	"github.com/streadway/amqp"
+)
+
+// cancelWait is how long drain waits for handlers to return after their contexts are cancelled
+const cancelWait = 5 * time.Second
+
+// deliveryTracker wraps AMQP message handlers so that a shutdown can stop handling new deliveries and wait for the
+// ones in flight to finish.
+type deliveryTracker struct {
+	mutex     sync.Mutex
+	draining  bool
+	consuming bool
+	inFlight  sync.WaitGroup
+
+	// consumers maps the tags of the consumers that deliveries have come from to their channels, so that they can be
+	// cancelled when draining starts. The messaging client doesn't expose them any other way.
+	consumers map[string]*amqp.Channel
+
+	// stopCtx is cancelled when the grace period runs out, which cancels the contexts of in-flight handlers
+	stopCtx context.Context
+	stop    context.CancelFunc
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	stopCtx, stop := context.WithCancel(context.Background())
+	return &deliveryTracker{stopCtx: stopCtx, stop: stop, consumers: make(map[string]*amqp.Channel)}
+}
+
+// cancelConsumer stops the broker from sending any more deliveries to a consumer. The mutex must be held.
+func (t *deliveryTracker) cancelConsumer(tag string, channel *amqp.Channel) {
+	if err := channel.Cancel(tag, false); err != nil {
+		log.WithField("consumer_tag", tag).Errorf("Error cancelling consumer: %s", err)
+	}
+	delete(t.consumers, tag)
+}
+
+// wrap returns a handler that requeues deliveries once draining has started, and otherwise calls handler with a
+// context that is cancelled if the grace period runs out.
+func (t *deliveryTracker) wrap(handler messaging.MessageHandler) messaging.MessageHandler {
+	return func(ctx context.Context, del amqp.Delivery) {
+		t.mutex.Lock()
+		channel, _ := del.Acknowledger.(*amqp.Channel)
+		if t.draining {
+			// The consumer is cancelled first, so that the requeued delivery goes to another instance instead of
+			// straight back to this one. Only deliveries prefetched before the cancellation end up here.
+			if channel != nil {
+				t.cancelConsumer(del.ConsumerTag, channel)
+			}
+			t.mutex.Unlock()
+			log.WithFields(deliveryFields(del)).Info("Shutting down, requeueing message")
+			nack(del, true)
+			return
+		}
+		if channel != nil && del.ConsumerTag != "" {
+			t.consumers[del.ConsumerTag] = channel
+		}
+		t.inFlight.Add(1)
+		t.mutex.Unlock()
+		defer t.inFlight.Done()
+
+		metrics.MessagesReceived.WithLabelValues(del.RoutingKey).Inc()
+		metrics.HandlersInFlight.Inc()
+		defer metrics.HandlersInFlight.Dec()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stopCancel := context.AfterFunc(t.stopCtx, cancel)
+		defer stopCancel()
+
+		handler(ctx, del)
+	}
+}
+
+// markConsuming records that the mode's consumer has been registered with the AMQP client
+func (t *deliveryTracker) markConsuming() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.consuming = true
+}
+
+// isConsuming returns whether the mode's consumer has been registered and deliveries aren't being drained
+func (t *deliveryTracker) isConsuming() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.consuming && !t.draining
+}
+
+// drain stops consuming new deliveries and waits up to gracePeriod for in-flight handlers to finish. If they haven't,
+// their contexts are cancelled so that they can requeue their deliveries. It returns false if any handlers were still
+// running when it gave up.
+func (t *deliveryTracker) drain(gracePeriod time.Duration) bool {
+	t.mutex.Lock()
+	t.draining = true
+	for tag, channel := range t.consumers {
+		t.cancelConsumer(tag, channel)
+	}
+	t.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(gracePeriod):
+	}
+
+	log.Warn("Grace period expired, cancelling in-flight messages.")
+	t.stop()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(cancelWait):
+		return false
+	}
+}
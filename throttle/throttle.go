@@ -0,0 +1,87 @@
+package throttle
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a type that limits how quickly work proceeds to a number of units per second, allowing up to a second's
+// worth of units at once. A nil Limiter, or one with a rate of zero, doesn't limit anything.
+type Limiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter that allows perSecond units per second
+func NewLimiter(perSecond float64) *Limiter {
+	return &Limiter{rate: perSecond, tokens: perSecond, last: time.Now()}
+}
+
+// SetRate changes the number of units allowed per second. It can be called while other goroutines are waiting.
+func (l *Limiter) SetRate(perSecond float64) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.refill(time.Now())
+	l.rate = perSecond
+}
+
+// Rate returns the number of units allowed per second
+func (l *Limiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rate
+}
+
+// refill adds the units allowed since the last call, up to a second's worth. The mutex must be held.
+func (l *Limiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens = math.Min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// Wait blocks until n units of work are allowed to proceed, or until the context is cancelled. The units of a
+// cancelled wait are given back, since the work never proceeded.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	if l.rate <= 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mutex.Lock()
+		l.tokens += float64(n)
+		l.mutex.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
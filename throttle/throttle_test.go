@@ -0,0 +1,106 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitUnlimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *Limiter
+	}{
+		{"nil limiter", nil},
+		{"zero rate", NewLimiter(0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			for i := 0; i < 100; i++ {
+				if err := tt.limiter.Wait(context.Background(), 1000); err != nil {
+					t.Fatalf("Wait() returned an error: %s", err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+				t.Errorf("Wait() blocked for %s without a limit", elapsed)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		waits   []int
+		minWait time.Duration
+		maxWait time.Duration
+	}{
+		{"within the burst", 100, []int{50, 50}, 0, 50 * time.Millisecond},
+		{"deficit", 100, []int{100, 10}, 80 * time.Millisecond, 500 * time.Millisecond},
+		{"larger than the burst", 100, []int{120}, 150 * time.Millisecond, 600 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.rate)
+			start := time.Now()
+			for _, n := range tt.waits {
+				if err := l.Wait(context.Background(), n); err != nil {
+					t.Fatalf("Wait() returned an error: %s", err)
+				}
+			}
+			elapsed := time.Since(start)
+			if elapsed < tt.minWait || elapsed > tt.maxWait {
+				t.Errorf("Wait() took %s, want between %s and %s", elapsed, tt.minWait, tt.maxWait)
+			}
+		})
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	l := NewLimiter(10)
+	if err := l.Wait(context.Background(), 10); err != nil {
+		t.Fatalf("Wait() returned an error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.Wait(ctx, 100); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Wait() took %s to notice the context was done", elapsed)
+	}
+
+	// The cancelled units are given back, so the limiter only owes what was used before
+	l.mutex.Lock()
+	tokens := l.tokens
+	l.mutex.Unlock()
+	if tokens < -1 {
+		t.Errorf("tokens = %f after a cancelled wait, want the cancelled units to be given back", tokens)
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	l := NewLimiter(1)
+	if err := l.Wait(context.Background(), 1); err != nil {
+		t.Fatalf("Wait() returned an error: %s", err)
+	}
+
+	l.SetRate(0)
+	if got := l.Rate(); got != 0 {
+		t.Errorf("Rate() = %f, want 0", got)
+	}
+	start := time.Now()
+	if err := l.Wait(context.Background(), 1000); err != nil {
+		t.Fatalf("Wait() returned an error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Wait() blocked for %s after the limit was removed", elapsed)
+	}
+}
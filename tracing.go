@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/cyverse-de/messaging/v9"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const otelName = "github.com/cyverse-de/templeton"
+
+// deliveryPropagator reads the trace context that publishers put in AMQP headers. It's used instead of the global
+// propagator, which is only set up when an exporter is configured.
+var deliveryPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// startDeliverySpan starts a span for handling a delivery as part of the trace the publisher sent it in, so that a
+// metadata change can be followed from the service that made it to the documents it updates. The span is linked to
+// the span in ctx if that belongs to a different trace.
+func startDeliverySpan(ctx context.Context, del amqp.Delivery, name string) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.rabbitmq.routing_key", del.RoutingKey),
+			attribute.Int64("messaging.rabbitmq.delivery_tag", int64(del.DeliveryTag)),
+			attribute.Bool("messaging.rabbitmq.redelivered", del.Redelivered),
+		),
+	}
+
+	current := trace.SpanContextFromContext(ctx)
+	remoteCtx := deliveryPropagator.Extract(ctx, messaging.AMQPHeaderCarrier(del.Headers))
+	remote := trace.SpanContextFromContext(remoteCtx)
+	if remote.IsValid() && remote.TraceID() != current.TraceID() {
+		ctx = remoteCtx
+		if current.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: current}))
+		}
+	}
+
+	return otel.Tracer(otelName).Start(ctx, name, opts...)
+}